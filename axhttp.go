@@ -2,17 +2,29 @@ package axtransport
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
 	"io"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
+const SessionHeader = "X-Ax-Session"
+
+var (
+	ErrNoSession       = errors.New("no session")
+	ErrTooManySessions = errors.New("too many sessions")
+	ErrForeignSession  = errors.New("session belongs to another address")
+)
+
 var (
 	opsRequestCount = promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace: "ax_transport",
@@ -28,34 +40,68 @@ var (
 )
 
 type AxHttp struct {
-	logger       zerolog.Logger
-	parentCtx    context.Context
-	ctx          context.Context
-	cancelFn     context.CancelFunc
-	timeout      time.Duration
-	parentRouter chi.Router
-	apiPath      string
-	bind         string
-	srv          *http.Server
-	binProcessor BinProcessor
-	handlerFunc  DataHandlerFunc
+	logger        zerolog.Logger
+	parentCtx     context.Context
+	ctx           context.Context
+	cancelFn      context.CancelFunc
+	timeout       time.Duration
+	eventTimeout  time.Duration
+	eventBufSize  int
+	maxSessions   int
+	maxIPSessions int
+	parentRouter  chi.Router
+	apiPath       string
+	bind          string
+	srv           *http.Server
+	tlsConfig     *tls.Config
+	binProcessor  BinProcessor
+	handlerFunc   DataHandlerFunc
+	interceptors  []Interceptor
+	rateLimiter   *RateLimiter
+	sessionsMu    sync.Mutex
+	sessions      map[string]*axHttpSession
+	ipSessions    map[string]int
+}
+
+// axHttpSession is created by a decoded POST and bound to the IP it came
+// from, only that IP may poll its events.
+type axHttpSession struct {
+	events   chan []byte
+	ip       string
+	lastSeen time.Time
+	polling  int
 }
 
 func NewAxHttp(ctx context.Context, logger zerolog.Logger, bind string, apiPath string, bin BinProcessor, handlerFunc DataHandlerFunc) *AxHttp {
 	res := &AxHttp{
-		logger:       logger,
-		parentCtx:    ctx,
-		timeout:      25 * time.Second,
-		bind:         bind,
-		parentRouter: chi.NewRouter(),
-		apiPath:      apiPath,
-		handlerFunc:  handlerFunc,
+		logger:        logger,
+		parentCtx:     ctx,
+		timeout:       25 * time.Second,
+		eventTimeout:  50 * time.Second,
+		eventBufSize:  200,
+		maxSessions:   10000,
+		maxIPSessions: 100,
+		bind:          bind,
+		parentRouter:  chi.NewRouter(),
+		apiPath:       apiPath,
+		handlerFunc:   handlerFunc,
+		sessions:      make(map[string]*axHttpSession),
+		ipSessions:    make(map[string]int),
 	}
 	res.binProcessor = bin.WithCompressionSize(1024) //NewAxBinProcessor(logger).WithCompressionSize(1024)
-	res.parentRouter.Post(res.apiPath, res.handler)
+	res.route(res.parentRouter)
 	return res
 }
 
+func (a *AxHttp) route(r chi.Router) {
+	r.Post(a.apiPath, a.handler)
+	r.Get(a.eventsPath(), a.eventsHandler)
+}
+
+func (a *AxHttp) eventsPath() string {
+	return a.apiPath + "/events"
+}
+
 func (a *AxHttp) WithAES(secretKey []byte) *AxHttp {
 	a.binProcessor.WithAES(secretKey)
 	return a
@@ -71,17 +117,55 @@ func (a *AxHttp) WithTimeout(timeout time.Duration) *AxHttp {
 	return a
 }
 
+func (a *AxHttp) WithEventTimeout(timeout time.Duration) *AxHttp {
+	a.eventTimeout = timeout
+	return a
+}
+
+func (a *AxHttp) WithEventBufSize(size int) *AxHttp {
+	a.eventBufSize = size
+	return a
+}
+
+// WithMaxSessions limits the event sessions kept at once, in total and per
+// remote IP. Requests that would open a further session get 503 until idle
+// sessions expire.
+func (a *AxHttp) WithMaxSessions(size, perIP int) *AxHttp {
+	a.maxSessions = size
+	a.maxIPSessions = perIP
+	return a
+}
+
+func (a *AxHttp) WithTLS(config *tls.Config) *AxHttp {
+	a.tlsConfig = config
+	return a
+}
+
+func (a *AxHttp) WithInterceptors(interceptors ...Interceptor) *AxHttp {
+	a.interceptors = append(a.interceptors, interceptors...)
+	return a
+}
+
+func (a *AxHttp) WithRateLimiter(limiter *RateLimiter) *AxHttp {
+	a.rateLimiter = limiter
+	return a
+}
+
 func (a *AxHttp) WithRouter(r chi.Router) *AxHttp {
 	a.parentRouter = r
-	r.Post(a.apiPath, a.handler)
+	a.route(r)
 	return a
 }
 
-func (a *AxHttp) Start() {
+func (a *AxHttp) Start() error {
 	a.logger.Info().Msgf("Starting HTTP server on %s", a.bind)
 	if a.ctx != nil && a.ctx.Err() == nil {
 		a.logger.Warn().Msg("HTTP server already starte")
-		return
+		return nil
+	}
+	listener, err := net.Listen("tcp", a.bind)
+	if err != nil {
+		return err
 	}
 	a.ctx, a.cancelFn = context.WithCancel(a.parentCtx)
 	a.srv = &http.Server{
@@ -89,9 +173,17 @@ func (a *AxHttp) Start() {
 		Handler:      a.parentRouter,
 		ReadTimeout:  a.timeout,
 		WriteTimeout: a.timeout,
+		TLSConfig:    a.tlsConfig,
 	}
+	go a.expireSessions()
 	go func() {
-		if err := a.srv.ListenAndServe(); err != nil {
+		var err error
+		if a.tlsConfig != nil {
+			err = a.srv.ServeTLS(listener, "", "")
+		} else {
+			err = a.srv.Serve(listener)
+		}
+		if err != nil {
 			if errors.Is(err, http.ErrServerClosed) {
 				a.logger.Info().Msg("HTTP server closed")
 			} else {
@@ -101,11 +193,26 @@ func (a *AxHttp) Start() {
 	}()
 	go func() {
 		<-a.ctx.Done()
-		err := a.srv.Shutdown(a.ctx)
+		// a.ctx is already canceled, give in-flight requests their own timeout
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		defer cancel()
+		err := a.srv.Shutdown(ctx)
 		if err != nil {
 			a.logger.Error().Err(err).Msg("HTTP server failed to stop")
 		}
 	}()
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight requests until
+// ctx is done. Pending long polls return immediately.
+func (a *AxHttp) Shutdown(ctx context.Context) error {
+	a.logger.Info().Msg("Shutting down HTTP server")
+	if a.srv == nil {
+		return nil
+	}
+	a.cancelFn()
+	return a.srv.Shutdown(ctx)
 }
 
 func (a *AxHttp) Stop() {
@@ -119,6 +226,15 @@ func (a *AxHttp) Stop() {
 
 func (a *AxHttp) handler(w http.ResponseWriter, r *http.Request) {
 	opsRequestCount.Inc()
+	if a.rateLimiter != nil {
+		if _, err := a.rateLimiter.take(r.Context(), "http", nil, r.RemoteAddr); err != nil {
+			if a.rateLimiter.Action() == RateLimitDisconnect {
+				w.Header().Set("Connection", "close")
+			}
+			writeHttpErr(w, http.StatusTooManyRequests, err)
+			return
+		}
+	}
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		opsHttpErrorCount.Inc()
@@ -126,21 +242,48 @@ func (a *AxHttp) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer r.Body.Close()
-	data, err = a.binProcessor.Unmarshal(data)
+	bin := a.binProcessor
+	if hello := r.Header.Get(HelloHeader); hello != "" {
+		if bin, err = a.hello(w, hello); err != nil {
+			opsHttpErrorCount.Inc()
+			writeHttpErr(w, http.StatusNotAcceptable, err)
+			return
+		}
+		if len(data) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	pck, err := unmarshalPacket(bin, data)
 	if err != nil {
 		opsHttpErrorCount.Inc()
 		writeHttpErr(w, http.StatusBadRequest, err)
 		return
 	}
+	if session := r.Header.Get(SessionHeader); session != "" {
+		if err = a.bindSession(session, remoteIP(r.RemoteAddr)); err != nil {
+			opsHttpErrorCount.Inc()
+			writeHttpErr(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	}
+	peer := &Peer{
+		Transport:  "http",
+		RemoteAddr: r.RemoteAddr,
+		Session:    r.Header.Get(SessionHeader),
+		TLS:        r.TLS,
+		Header:     r.Header,
+	}
 	startTime := time.Now()
-	data, err = a.handlerFunc(data, nil)
+	handler := intercept(a.interceptors, a.handlerFunc, peer)
+	data, err = handler(pck.Payload, withPeer(r.Context(), peer))
 	opsRequestDuration.WithLabelValues("http").Observe(time.Since(startTime).Seconds())
 	if err != nil {
 		opsHttpErrorCount.Inc()
 		writeHttpErr(w, http.StatusInternalServerError, err)
 		return
 	}
-	data, err = a.binProcessor.Marshal(data)
+	data, err = marshalPacket(bin, &protobuf.PPacket{Payload: data, RequestId: pck.RequestId, Version: pck.Version})
 	if err != nil {
 		opsHttpErrorCount.Inc()
 		writeHttpErr(w, http.StatusInternalServerError, err)
@@ -150,6 +293,185 @@ func (a *AxHttp) handler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+// hello answers the client capabilities with the negotiated configuration
+// and returns the processor for the response. A request with an empty body
+// is a hello only.
+func (a *AxHttp) hello(w http.ResponseWriter, hello string) (BinProcessor, error) {
+	h, err := helloBinProcessor(a.binProcessor)
+	if err != nil {
+		return nil, err
+	}
+	client, err := decodeHello(hello)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIncompatible, err)
+	}
+	n, err := negotiate(capabilitiesFromProto(client), h.Capabilities())
+	if err != nil {
+		return nil, err
+	}
+	reply, err := encodeHello(n.proto())
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set(HelloHeader, reply)
+	return h.WithNegotiated(n), nil
+}
+
+// SendToSession queues data for the next poll of session. The session must
+// have sent a request before, otherwise ErrNoSession is returned. Delivery is at most
+// once: events are dropped when writing the poll response fails.
+func (a *AxHttp) SendToSession(session string, data []byte) error {
+	if session == "" {
+		return ErrNoSession
+	}
+	data, err := a.binProcessor.Marshal(data)
+	if err != nil {
+		return err
+	}
+	a.sessionsMu.Lock()
+	s, ok := a.sessions[session]
+	if ok {
+		s.lastSeen = time.Now()
+	}
+	a.sessionsMu.Unlock()
+	if !ok {
+		return ErrNoSession
+	}
+	select {
+	case s.events <- data:
+		return nil
+	default:
+		return ErrTooMuchData
+	}
+}
+
+// bindSession creates the session of a decoded request, or moves it to ip.
+func (a *AxHttp) bindSession(session, ip string) error {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	s, ok := a.sessions[session]
+	if ok && s.ip == ip {
+		s.lastSeen = time.Now()
+		return nil
+	}
+	if a.maxIPSessions > 0 && a.ipSessions[ip] >= a.maxIPSessions {
+		return fmt.Errorf("%w: %s", ErrTooManySessions, ip)
+	}
+	if !ok {
+		if a.maxSessions > 0 && len(a.sessions) >= a.maxSessions {
+			return ErrTooManySessions
+		}
+		s = &axHttpSession{events: make(chan []byte, a.eventBufSize)}
+		a.sessions[session] = s
+	} else {
+		a.releaseIP(s.ip)
+	}
+	s.ip = ip
+	a.ipSessions[ip]++
+	s.lastSeen = time.Now()
+	return nil
+}
+
+func (a *AxHttp) releaseIP(ip string) {
+	if a.ipSessions[ip] <= 1 {
+		delete(a.ipSessions, ip)
+	} else {
+		a.ipSessions[ip]--
+	}
+}
+
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func (a *AxHttp) expireSessions() {
+	ticker := time.NewTicker(a.eventTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.sessionsMu.Lock()
+			for id, s := range a.sessions {
+				if s.polling == 0 && time.Since(s.lastSeen) > 2*a.eventTimeout {
+					delete(a.sessions, id)
+					a.releaseIP(s.ip)
+				}
+			}
+			a.sessionsMu.Unlock()
+		}
+	}
+}
+
+func (a *AxHttp) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	opsRequestCount.Inc()
+	session := r.Header.Get(SessionHeader)
+	if session == "" {
+		opsHttpErrorCount.Inc()
+		writeHttpErr(w, http.StatusBadRequest, ErrNoSession)
+		return
+	}
+	a.sessionsMu.Lock()
+	s, ok := a.sessions[session]
+	if !ok || s.ip != remoteIP(r.RemoteAddr) {
+		a.sessionsMu.Unlock()
+		opsHttpErrorCount.Inc()
+		if !ok {
+			writeHttpErr(w, http.StatusNotFound, ErrNoSession)
+		} else {
+			writeHttpErr(w, http.StatusForbidden, ErrForeignSession)
+		}
+		return
+	}
+	s.lastSeen = time.Now()
+	s.polling++
+	a.sessionsMu.Unlock()
+	defer func() {
+		a.sessionsMu.Lock()
+		s.polling--
+		s.lastSeen = time.Now()
+		a.sessionsMu.Unlock()
+	}()
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(a.eventTimeout + a.timeout)); err != nil {
+		a.logger.Warn().Err(err).Msg("can't extend events write deadline")
+	}
+	timer := time.NewTimer(a.eventTimeout)
+	defer timer.Stop()
+	var data []byte
+	select {
+	case <-a.ctx.Done():
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case <-r.Context().Done():
+		return
+	case <-timer.C:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case event := <-s.events:
+		data = addSize32(event)
+	}
+drain:
+	for {
+		select {
+		case event := <-s.events:
+			data = append(data, addSize32(event)...)
+		default:
+			break drain
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := w.Write(data); err != nil {
+		// events are delivered at most once
+		a.logger.Warn().Err(err).Str("session", session).Msg("events lost")
+	}
+}
+
 func writeHttpErr(w http.ResponseWriter, code int, err error) {
 	w.WriteHeader(code)
 	errStackTrace := fmt.Sprintf("%+v", err)
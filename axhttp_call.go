@@ -0,0 +1,225 @@
+package axtransport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxErrorBody limits the server error body kept in HttpStatusError.
+const maxErrorBody = 64 * 1024
+
+// HttpStatusError is returned for responses other than 200.
+type HttpStatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func newHttpStatusError(resp *http.Response) *HttpStatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &HttpStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("bad status code (%d) %s", e.StatusCode, e.Status)
+}
+
+// RetryPolicy retries a call up to Attempts times in total. RetryOn decides
+// which errors are retried, by default network errors, 502, 503, 504 and 429.
+// The server answers 500 for handler errors, retry it with RetryOn only when
+// the handler is idempotent.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  Backoff
+	RetryOn  func(err error) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Backoff:  Backoff{Min: 100 * time.Millisecond, Max: 2 * time.Second, Factor: 2, Jitter: 0.2},
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.RetryOn != nil {
+		return p.RetryOn(err)
+	}
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+type CallOption func(o *callOptions)
+
+type callOptions struct {
+	retry          RetryPolicy
+	timeout        time.Duration
+	header         http.Header
+	idempotencyKey string
+}
+
+// WithRetry retries failed calls. Unless WithIdempotencyKey is given every
+// attempt carries the same generated idempotency key.
+func WithRetry(policy RetryPolicy) CallOption {
+	return func(o *callOptions) {
+		o.retry = policy
+	}
+}
+
+// WithCallTimeout bounds every attempt instead of the client default, it
+// can be longer than the default.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+func WithHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.header == nil {
+			o.header = http.Header{}
+		}
+		o.header.Add(key, value)
+	}
+}
+
+func WithIdempotencyKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// Do posts data to url and returns the response payload. Status errors are
+// returned as *HttpStatusError.
+func (a *AxHttpClient) Do(ctx context.Context, url string, data []byte, opts ...CallOption) ([]byte, error) {
+	o := callOptions{retry: RetryPolicy{Attempts: 1}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.retry.Attempts > 1 && o.idempotencyKey == "" {
+		o.idempotencyKey = newSessionId()
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := a.do(ctx, url, data, &o)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt+1 >= o.retry.Attempts || !o.retry.retryable(err) {
+			return nil, err
+		}
+		a.logger.Debug().Err(err).Str("url", url).Int("attempt", attempt+1).Msg("retry http call")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(o.retry.Backoff.delay(attempt)):
+		}
+	}
+}
+
+// Hello negotiates a common configuration with the server at url and uses
+// it for the following calls.
+func (a *AxHttpClient) Hello(ctx context.Context, url string) (Negotiated, error) {
+	h, err := helloBinProcessor(a.binProcessor)
+	if err != nil {
+		return Negotiated{}, err
+	}
+	caps := h.Capabilities()
+	hello, err := encodeHello(caps.proto())
+	if err != nil {
+		return Negotiated{}, err
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return Negotiated{}, err
+	}
+	req.Header.Set(SessionHeader, a.session)
+	req.Header.Set(HelloHeader, hello)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Negotiated{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return Negotiated{}, newHttpStatusError(resp)
+	}
+	reply, err := decodeHello(resp.Header.Get(HelloHeader))
+	if err != nil {
+		return Negotiated{}, fmt.Errorf("%w: %v", ErrIncompatible, err)
+	}
+	n, err := negotiatedFromProto(reply)
+	if err == nil {
+		err = caps.accepts(n)
+	}
+	if err != nil {
+		return Negotiated{}, err
+	}
+	a.binProcessor, a.hello = h.WithNegotiated(n), hello
+	return n, nil
+}
+
+func (a *AxHttpClient) do(ctx context.Context, url string, data []byte, o *callOptions) ([]byte, error) {
+	timeout := o.timeout
+	if timeout <= 0 {
+		timeout = a.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// marshal every attempt, replay protection needs a fresh nonce
+	body, err := a.binProcessor.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to marshal: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range o.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(SessionHeader, a.session)
+	if o.idempotencyKey != "" {
+		req.Header.Set(IdempotencyHeader, o.idempotencyKey)
+	}
+	if a.hello != "" {
+		req.Header.Set(HelloHeader, a.hello)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHttpStatusError(resp)
+	}
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return a.binProcessor.Unmarshal(body)
+}
@@ -0,0 +1,114 @@
+package axtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingTransport struct {
+	calls atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAxHttpClient_Do(t *testing.T) {
+	var calls atomic.Int32
+	keys := make(chan string, 10)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		peer, _ := PeerFromContext(ctx)
+		keys <- peer.Header.Get(IdempotencyHeader) + "|" + peer.Header.Get("X-Trace")
+		switch string(d) {
+		case "flaky":
+			if calls.Add(1) < 3 {
+				return nil, errors.New("not yet")
+			}
+		case "slow":
+			time.Sleep(300 * time.Millisecond)
+		case "broken":
+			return nil, errors.New("broken handler")
+		}
+		return d, nil
+	}
+	transport := AxTransport().WithHTTPServer("localhost", 8088).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	counter := &countingTransport{}
+	client := NewAxHttpClient(nil)
+	client.SetTransport(counter)
+	retry := RetryPolicy{Attempts: 3, Backoff: Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}}
+	_, err := client.Do(context.Background(), "http://localhost:8088/api", []byte("broken"), WithRetry(retry))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), counter.calls.Load())
+	<-keys
+
+	// the flaky handler is idempotent, so its 500 may be retried
+	retry500 := retry
+	retry500.RetryOn = func(err error) bool {
+		var statusErr *HttpStatusError
+		return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusInternalServerError
+	}
+	counter.calls.Store(0)
+	data, err := client.Do(context.Background(), "http://localhost:8088/api", []byte("flaky"),
+		WithRetry(retry500), WithHeader("X-Trace", "abc"))
+	require.Nil(t, err)
+	assert.Equal(t, "flaky", string(data))
+	assert.Equal(t, int32(3), counter.calls.Load())
+	first := <-keys
+	assert.NotEqual(t, "|abc", first)
+	assert.Equal(t, first, <-keys)
+	assert.Equal(t, first, <-keys)
+
+	_, err = client.Do(context.Background(), "http://localhost:8088/api", []byte("broken"), WithIdempotencyKey("k1"))
+	var statusErr *HttpStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	assert.Contains(t, string(statusErr.Body), "broken handler")
+	assert.Equal(t, "k1|", <-keys)
+
+	_, err = client.Do(context.Background(), "http://localhost:8088/api", []byte("slow"), WithCallTimeout(50*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	<-keys
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Do(ctx, "http://localhost:8088/api", []byte("hello"), WithRetry(retry))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAxHttpClient_SetHTTPClientCopies(t *testing.T) {
+	httpClient := &http.Client{}
+	client := NewAxHttpClient(nil)
+	client.SetHTTPClient(httpClient)
+	client.SetTransport(&countingTransport{})
+	client.SetTLS(&tls.Config{})
+	assert.Nil(t, httpClient.Transport)
+}
+
+func TestAxHttpClient_CallTimeoutExtendsDefault(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		time.Sleep(150 * time.Millisecond)
+		return d, nil
+	}
+	transport := AxTransport().WithHTTPServer("localhost", 8121).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client := NewAxHttpClientBuilder().WithTimeout(50 * time.Millisecond).Build()
+	_, err := client.Do(context.Background(), "http://localhost:8121/api", []byte("slow"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	data, err := client.Do(context.Background(), "http://localhost:8121/api", []byte("slow"), WithCallTimeout(time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, "slow", string(data))
+}
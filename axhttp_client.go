@@ -1,9 +1,11 @@
 package axtransport
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"github.com/rs/zerolog"
 	"io"
 	"net/http"
@@ -19,49 +21,221 @@ zed (12.03.2024)
 */
 
 type AxHttpClient struct {
-	client       http.Client
-	binProcessor *AxBinProcessor
+	client       *http.Client
+	eventClient  *http.Client
+	binProcessor BinProcessor
+	logger       zerolog.Logger
+	hello        string
+	session      string
+	handlerFunc  DataReceiveFunc
+	tlsConfig    *tls.Config
+	pins         [][]byte
+	// timeout bounds calls without WithCallTimeout, the http.Client has
+	// none so WithCallTimeout can extend it.
+	timeout time.Duration
 }
 
 func NewAxHttpClient(secret []byte) *AxHttpClient {
-	client := http.Client{
-		Timeout: 5 * time.Second,
+	return NewAxHttpClientBuilder().WithAES(secret).Build()
+}
+
+type HttpClientBuilder struct {
+	binProcessor       BinProcessor
+	aesSecret          []byte
+	compressionSize    int
+	compressionSizeSet bool
+	timeout            time.Duration
+	timeoutSet         bool
+	httpClient         *http.Client
+	logger             zerolog.Logger
+}
+
+func NewAxHttpClientBuilder() *HttpClientBuilder {
+	return &HttpClientBuilder{
+		compressionSize: 1024,
+		timeout:         5 * time.Second,
+		logger:          zerolog.Nop(),
 	}
+}
+
+// WithBinProcessor sets the processor, it must match the server one. Its
+// compression size is kept unless WithCompressionSize is called.
+func (b *HttpClientBuilder) WithBinProcessor(processor BinProcessor) *HttpClientBuilder {
+	b.binProcessor = processor
+	return b
+}
+
+func (b *HttpClientBuilder) WithAES(secret []byte) *HttpClientBuilder {
+	b.aesSecret = secret
+	return b
+}
+
+// WithCompressionSize compresses payloads larger than size, 0 disables it.
+func (b *HttpClientBuilder) WithCompressionSize(size int) *HttpClientBuilder {
+	b.compressionSize = size
+	b.compressionSizeSet = true
+	return b
+}
+
+// WithTimeout bounds every call without WithCallTimeout. A client set by
+// WithHTTPClient keeps its own timeout as well, which caps every call.
+func (b *HttpClientBuilder) WithTimeout(timeout time.Duration) *HttpClientBuilder {
+	b.timeout = timeout
+	b.timeoutSet = true
+	return b
+}
+
+// WithHTTPClient sets the client used for calls. The client is copied and
+// keeps its own timeout.
+func (b *HttpClientBuilder) WithHTTPClient(client *http.Client) *HttpClientBuilder {
+	b.httpClient = client
+	return b
+}
+
+func (b *HttpClientBuilder) WithLogger(logger zerolog.Logger) *HttpClientBuilder {
+	b.logger = logger
+	return b
+}
+
+func (b *HttpClientBuilder) Build() *AxHttpClient {
 	res := &AxHttpClient{
-		client: client,
+		client:       &http.Client{},
+		eventClient:  &http.Client{},
+		binProcessor: b.binProcessor,
+		logger:       b.logger,
+		session:      newSessionId(),
+	}
+	if b.httpClient != nil {
+		res.SetHTTPClient(b.httpClient)
 	}
-	res.binProcessor = NewAxBinProcessor(zerolog.Nop())
-	if secret != nil {
-		res.binProcessor.WithAES(secret)
+	if b.httpClient == nil || b.timeoutSet {
+		res.timeout = b.timeout
+	}
+	compressionSizeSet := b.compressionSizeSet
+	if res.binProcessor == nil {
+		res.binProcessor = NewAxBinProcessor(b.logger)
+		compressionSizeSet = true
+	}
+	if b.aesSecret != nil {
+		res.binProcessor.WithAES(b.aesSecret)
+	}
+	if compressionSizeSet {
+		res.binProcessor.WithCompressionSize(b.compressionSize)
 	}
 	return res
 }
 
+func newSessionId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (a *AxHttpClient) Session() string {
+	return a.session
+}
+
+func (a *AxHttpClient) SetSession(session string) {
+	a.session = session
+}
+
+func (a *AxHttpClient) SetTLS(config *tls.Config) {
+	a.tlsConfig = config
+	a.applyTLS()
+}
+
+func (a *AxHttpClient) SetPinnedCertificates(pins ...[]byte) {
+	a.pins = pins
+	a.applyTLS()
+}
+
+func (a *AxHttpClient) applyTLS() {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = pinnedTLSConfig(a.tlsConfig, a.pins)
+	a.client.Transport = transport
+	a.eventClient.Transport = transport
+}
+
+// SetHTTPClient replaces the client used by Post and Do. Its transport is
+// used for events too. The client is copied, so SetTLS and SetTransport
+// don't change the caller's client. Calls are bounded by the client timeout
+// from now on, the default call timeout is dropped.
+func (a *AxHttpClient) SetHTTPClient(client *http.Client) {
+	c := *client
+	a.client = &c
+	a.timeout = 0
+	a.eventClient = &http.Client{Transport: client.Transport}
+}
+
+func (a *AxHttpClient) SetTransport(transport http.RoundTripper) {
+	a.client.Transport = transport
+	a.eventClient.Transport = transport
+}
+
+func (a *AxHttpClient) SetHandler(handler DataReceiveFunc) {
+	a.handlerFunc = handler
+}
+
 func (a *AxHttpClient) Post(url string, data []byte) ([]byte, error) {
-	var err error
-	data, err = a.binProcessor.Marshal(data)
-	if err != nil {
-		return nil, errors.New("fail to marshal:" + err.Error())
+	return a.Do(context.Background(), url, data)
+}
+
+// PollEvents receives the events of the client session until ctx is done.
+// The server creates the session on the first request, so Post or Do must
+// succeed before polling.
+func (a *AxHttpClient) PollEvents(ctx context.Context, url string) error {
+	if a.handlerFunc == nil {
+		return errors.New("handler func is nil")
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
-	if err != nil {
-		return nil, err
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.pollEvents(ctx, url); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
 	}
-	req.Header.Add("Content-Type", "application/octet-stream")
-	resp, err := a.client.Do(req)
+}
+
+func (a *AxHttpClient) pollEvents(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(fmt.Sprintf("bad status code (%d) %s", resp.StatusCode, resp.Status))
-	}
-	data, err = io.ReadAll(resp.Body)
+	req.Header.Add(SessionHeader, a.session)
+	resp, err := a.eventClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	data, err = a.binProcessor.Unmarshal(data)
-	if err != nil {
-		return nil, err
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+	default:
+		return newHttpStatusError(resp)
+	}
+	for {
+		sizeBytes, err := readNBytes(resp.Body, 4)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, err := readNBytes(resp.Body, int(getUInt32FromBytes(sizeBytes)))
+		if err != nil {
+			return err
+		}
+		data, err = a.binProcessor.Unmarshal(data)
+		if err != nil {
+			return err
+		}
+		if err = a.handlerFunc(data, ctx); err != nil {
+			return err
+		}
 	}
-	return data, nil
 }
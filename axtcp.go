@@ -2,14 +2,19 @@ package axtransport
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,60 +42,140 @@ var (
 )
 
 type AxTcp struct {
+	logger              zerolog.Logger
+	parentCtx           context.Context
+	ctx                 context.Context
+	cancelFn            context.CancelFunc
+	timeout             time.Duration
+	bind                string
+	writeBufSize        int
+	writeTimeout        time.Duration
+	backpressure        BackpressurePolicy
+	backpressureTimeout time.Duration
+	maxMessageSize      int
+	listener            net.Listener
+	tlsConfig           *tls.Config
+	handshake           *Handshake
+	hello               bool
+	binProcessor        BinProcessor
+	handlerFunc         DataHandlerFunc
+	interceptors        []Interceptor
+	rateLimiter         *RateLimiter
+	limits              ConcurrencyLimits
+	connSem             semaphore
+	workerSem           semaphore
+	dispatchMode        DispatchMode
+	orderingKey         OrderingKeyFunc
+	conns               *connRegistry[*AxTcpConnection]
+	wg                  sync.WaitGroup
+	draining            atomic.Bool
+}
+
+type AxTcpConnection struct {
+	id           uint64
 	logger       zerolog.Logger
-	parentCtx    context.Context
+	conn         net.Conn
+	out          *outQueue
+	writeTimeout time.Duration
 	ctx          context.Context
 	cancelFn     context.CancelFunc
-	timeout      time.Duration
-	bind         string
-	writeBufSize int
-	listener     net.Listener
 	binProcessor BinProcessor
-	handlerFunc  DataHandlerFunc
+	peer         *Peer
+	flushCh      chan chan struct{}
+	readMu       sync.Mutex
+	draining     bool
 }
 
-type AxTcpConnection struct {
-	logger   zerolog.Logger
-	conn     net.Conn
-	outSize  int
-	outChan  chan []byte
-	ctx      context.Context
-	cancelFn context.CancelFunc
+func NewAxTcpConnection(ctx context.Context, logger zerolog.Logger, conn net.Conn, outSize int) *AxTcpConnection {
+	res := newAxTcpConnection(ctx, logger, conn, newOutQueue(outSize, BackpressureDropNewest, 0))
+	res.start()
+	return res
 }
 
-func NewAxTcpConnection(ctx context.Context, logger zerolog.Logger, conn net.Conn, outSize int) *AxTcpConnection {
+func newAxTcpConnection(ctx context.Context, logger zerolog.Logger, conn net.Conn, out *outQueue) *AxTcpConnection {
 	res := &AxTcpConnection{
-		logger:  logger,
-		conn:    conn,
-		outSize: outSize,
-		outChan: make(chan []byte, outSize),
+		id:           connectionIdSeq.Add(1),
+		logger:       logger,
+		conn:         conn,
+		out:          out,
+		writeTimeout: time.Second * 5,
+		flushCh:      make(chan chan struct{}),
 	}
-	res.ctx, res.cancelFn = context.WithCancel(ctx)
-	res.ctx = context.WithValue(res.ctx, "connection", res)
+	res.peer = connPeer("tcp", conn, res.id)
+	res.ctx, res.cancelFn = context.WithCancel(withPeer(ctx, res.peer))
+	return res
+}
+
+func (a *AxTcpConnection) start() {
 	go func() {
-		defer conn.Close()
+		defer a.conn.Close()
 		for {
 			select {
-			case <-res.ctx.Done():
-				close(res.outChan)
+			case <-a.ctx.Done():
 				return
-			case data, ok := <-res.outChan:
-				if !ok {
+			case frames := <-a.out.ch:
+				if !a.writeFrames(frames) {
 					return
 				}
-				if err := conn.SetWriteDeadline(time.Now().Add(time.Second * 5)); err != nil {
-					res.logger.Error().Err(err).Msg("can't set write deadline to connection")
-				}
-				_, err := conn.Write(addSize32(data))
-				if err != nil {
-					res.logger.Error().Err(err).Msg("can't write to connection")
-					opsTcpErrorCount.Inc()
-					return
+			case done := <-a.flushCh:
+				for len(a.out.ch) > 0 {
+					if !a.writeFrames(<-a.out.ch) {
+						return
+					}
 				}
+				close(done)
 			}
 		}
 	}()
-	return res
+}
+
+func (a *AxTcpConnection) writeFrames(frames [][]byte) bool {
+	for _, frame := range frames {
+		if err := a.conn.SetWriteDeadline(time.Now().Add(a.writeTimeout)); err != nil {
+			a.logger.Error().Err(err).Msg("can't set write deadline to connection")
+		}
+		_, err := a.conn.Write(frame)
+		if err != nil {
+			a.logger.Error().Err(err).Msg("can't write to connection")
+			opsTcpErrorCount.Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// flush waits until everything queued so far is written.
+func (a *AxTcpConnection) flush() error {
+	done := make(chan struct{})
+	select {
+	case <-a.ctx.Done():
+		return a.ctx.Err()
+	case a.flushCh <- done:
+	}
+	select {
+	case <-a.ctx.Done():
+		return a.ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// stopReading makes the pending and every later read fail immediately.
+func (a *AxTcpConnection) stopReading() {
+	a.readMu.Lock()
+	defer a.readMu.Unlock()
+	a.draining = true
+	_ = a.conn.SetReadDeadline(time.Now())
+}
+
+func (a *AxTcpConnection) isDraining() bool {
+	a.readMu.Lock()
+	defer a.readMu.Unlock()
+	return a.draining
+}
+
+func (a *AxTcpConnection) ID() uint64 {
+	return a.id
 }
 
 func (a *AxTcpConnection) Close() {
@@ -98,28 +183,59 @@ func (a *AxTcpConnection) Close() {
 }
 
 var (
-	ErrTooMuchData = errors.New("too many data in out chan")
+	ErrTooMuchData        = errors.New("too many data in out chan")
+	ErrConnectionNotFound = errors.New("connection not found")
 )
 
 func (a *AxTcpConnection) Write(data []byte) error {
-	if len(a.outChan) > a.outSize/2 {
-		a.logger.Error().Err(a.ctx.Err()).Msg("too much data in out chan")
-		return ErrTooMuchData
-	}
+	return a.WriteContext(context.Background(), data)
+}
+
+// WriteContext queues data, ctx bounds the wait of BackpressureBlock.
+func (a *AxTcpConnection) WriteContext(ctx context.Context, data []byte) error {
 	if a.ctx.Err() != nil {
 		a.logger.Error().Err(a.ctx.Err()).Msg("can't write to connection out chan")
 		opsTcpErrorCount.Inc()
 		return a.ctx.Err()
 	}
-	a.outChan <- data
+	frames, err := dataFrames(data)
+	if err != nil {
+		return err
+	}
+	if err = a.out.push(a.ctx, ctx, frames, a.Close); err != nil {
+		a.logger.Error().Err(err).Str("policy", a.out.policy.String()).Msg("too much data in out chan")
+		return err
+	}
 	return nil
 }
 
+func (a *AxTcpConnection) writeControl(c *protobuf.PControl) error {
+	frame, err := marshalControl(c)
+	if err != nil {
+		return err
+	}
+	return a.out.push(a.ctx, context.Background(), [][]byte{frame}, a.Close)
+}
+
+// writeError answers the request with an error control frame.
+func (a *AxTcpConnection) writeError(requestId uint64, code protobuf.PErrorCode, err error) error {
+	return a.writeControl(&protobuf.PControl{
+		Type:      protobuf.PControlType_P_CONTROL_ERROR,
+		RequestId: requestId,
+		Error:     &protobuf.PError{Code: code, Message: err.Error()},
+	})
+}
+
 func (a *AxTcpConnection) Read(b []byte) (n int, err error) {
 	return a.conn.Read(b)
 }
 
 func (a *AxTcpConnection) SetReadDeadline(t time.Time) error {
+	a.readMu.Lock()
+	defer a.readMu.Unlock()
+	if a.draining {
+		return a.conn.SetReadDeadline(time.Now())
+	}
 	return a.conn.SetReadDeadline(t)
 }
 
@@ -133,11 +249,14 @@ func (a *AxTcpConnection) RemoteAddr() net.Addr {
 
 func NewAxTcp(ctx context.Context, logger zerolog.Logger, bind string, writeBufSize int, bin BinProcessor, handlerFunc DataHandlerFunc) *AxTcp {
 	res := &AxTcp{
-		logger:       logger,
-		parentCtx:    ctx,
-		bind:         bind,
-		writeBufSize: writeBufSize,
-		handlerFunc:  handlerFunc,
+		logger:         logger,
+		parentCtx:      ctx,
+		bind:           bind,
+		writeBufSize:   writeBufSize,
+		writeTimeout:   time.Second * 5,
+		maxMessageSize: MaxMessageSize,
+		handlerFunc:    handlerFunc,
+		conns:          newConnRegistry[*AxTcpConnection](),
 	}
 	res.binProcessor = bin.WithCompressionSize(1024) //NewAxBinProcessor(logger).WithCompressionSize(1024)
 	return res
@@ -158,6 +277,63 @@ func (a *AxTcp) WithTimeout(timeout time.Duration) *AxTcp {
 	return a
 }
 
+func (a *AxTcp) WithTLS(config *tls.Config) *AxTcp {
+	a.tlsConfig = config
+	return a
+}
+
+func (a *AxTcp) WithHandshake(handshake *Handshake) *AxTcp {
+	a.handshake = handshake
+	return a
+}
+
+// WithHello makes clients start with a hello frame, see Capabilities.
+func (a *AxTcp) WithHello(enabled bool) *AxTcp {
+	a.hello = enabled
+	return a
+}
+
+func (a *AxTcp) WithWriteTimeout(timeout time.Duration) *AxTcp {
+	a.writeTimeout = timeout
+	return a
+}
+
+func (a *AxTcp) WithBackpressure(policy BackpressurePolicy, timeout time.Duration) *AxTcp {
+	a.backpressure = policy
+	a.backpressureTimeout = timeout
+	return a
+}
+
+func (a *AxTcp) WithInterceptors(interceptors ...Interceptor) *AxTcp {
+	a.interceptors = append(a.interceptors, interceptors...)
+	return a
+}
+
+func (a *AxTcp) WithRateLimiter(limiter *RateLimiter) *AxTcp {
+	a.rateLimiter = limiter
+	return a
+}
+
+func (a *AxTcp) WithConcurrencyLimits(limits ConcurrencyLimits) *AxTcp {
+	a.limits = limits
+	a.connSem = newSemaphore(limits.MaxConnections)
+	a.workerSem = newSemaphore(limits.Workers)
+	return a
+}
+
+// WithDispatchMode sets the order of handler calls of one connection, key is
+// used by DispatchKeyed.
+func (a *AxTcp) WithDispatchMode(mode DispatchMode, key OrderingKeyFunc) *AxTcp {
+	a.dispatchMode = mode
+	a.orderingKey = key
+	return a
+}
+
+func (a *AxTcp) WithMaxMessageSize(size int) *AxTcp {
+	a.maxMessageSize = size
+	return a
+}
+
 func (a *AxTcp) WithWriteBUfSize(size int) *AxTcp {
 	a.writeBufSize = size
 	return a
@@ -166,11 +342,16 @@ func (a *AxTcp) WithWriteBUfSize(size int) *AxTcp {
 func (a *AxTcp) Start() error {
 	var err error
 	a.ctx, a.cancelFn = context.WithCancel(a.parentCtx)
+	a.draining.Store(false)
 	a.logger.Debug().Str("bind", a.bind).Msg("start tcp server")
 	a.listener, err = net.Listen("tcp", a.bind)
 	if err != nil {
 		return err
 	}
+	if a.tlsConfig != nil {
+		a.listener = tls.NewListener(a.listener, a.tlsConfig)
+	}
+	a.wg.Add(1)
 	go a.listen()
 	return nil
 }
@@ -180,20 +361,111 @@ func (a *AxTcp) Stop() {
 	_ = a.listener.Close()
 }
 
+// Shutdown stops accepting connections and requests, waits for in-flight
+// handlers and flushes their replies, then closes every connection. When ctx
+// is done first the remaining connections are closed at once.
+func (a *AxTcp) Shutdown(ctx context.Context) error {
+	if a.listener == nil {
+		return nil
+	}
+	a.draining.Store(true)
+	_ = a.listener.Close()
+	for _, conn := range a.conns.all() {
+		conn.stopReading()
+	}
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	defer a.cancelFn()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *AxTcp) Connections() []uint64 {
+	return a.conns.ids()
+}
+
+func (a *AxTcp) Connection(id uint64) (*AxTcpConnection, bool) {
+	return a.conns.get(id)
+}
+
+func (a *AxTcp) SendTo(id uint64, data []byte) error {
+	conn, ok := a.conns.get(id)
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	data, err := conn.binProcessor.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return conn.Write(data)
+}
+
+func (a *AxTcp) Broadcast(data []byte) error {
+	shared, err := a.binProcessor.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, conn := range a.conns.all() {
+		out := shared
+		if a.handshake != nil || a.hello {
+			// every connection has its own session key or negotiated version
+			if out, err = conn.binProcessor.Marshal(data); err != nil {
+				errs = append(errs, fmt.Errorf("connection %d: %w", conn.ID(), err))
+				continue
+			}
+		}
+		if err = conn.Write(out); err != nil {
+			errs = append(errs, fmt.Errorf("connection %d: %w", conn.ID(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (a *AxTcp) listen() {
+	defer a.wg.Done()
 	for {
 		select {
 		case <-a.ctx.Done():
 			return
 		default:
+			// with OverLimitWait new connections stay in the listen backlog
+			if a.limits.Action == OverLimitWait {
+				if err := acquireSlots(a.ctx, OverLimitWait, limitSlot{"connections", a.connSem}); err != nil {
+					return
+				}
+			}
 			conn, err := a.listener.Accept()
-			if err != nil && a.ctx.Err() == nil {
-				a.logger.Warn().Err(err).Msg("accept failed")
-				continue
-			} else if err != nil {
+			if err != nil {
+				if a.limits.Action == OverLimitWait {
+					a.connSem.release()
+				}
+				if a.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+					a.logger.Warn().Err(err).Msg("accept failed")
+					continue
+				}
 				return
 			}
-			go a.handleConn(conn)
+			if a.limits.Action == OverLimitReject {
+				if err = acquireSlots(a.ctx, OverLimitReject, limitSlot{"connections", a.connSem}); err != nil {
+					a.logger.Warn().Err(err).Str("remote", conn.RemoteAddr().String()).Msg("connection refused")
+					_ = conn.Close()
+					continue
+				}
+			}
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				defer a.connSem.release()
+				a.handleConn(conn)
+			}()
 		}
 	}
 }
@@ -203,72 +475,165 @@ func (a *AxTcp) handleConn(conn net.Conn) {
 	opsConnectionsCount.Inc()
 	defer opsConnectionsCount.Dec()
 	defer conn.Close()
-	axConn := NewAxTcpConnection(a.ctx, a.logger, conn, a.writeBufSize)
-	defer axConn.Close()
-	for {
-		err := conn.SetReadDeadline(time.Now().Add(a.timeout))
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		hsCtx, cancel := context.WithTimeout(a.ctx, a.timeout)
+		err := tlsConn.HandshakeContext(hsCtx)
+		cancel()
 		if err != nil {
-			log.Error().Err(err).Msg("set read deadline failed")
+			log.Error().Err(err).Msg("tls handshake failed")
 			opsTcpErrorCount.Inc()
 			return
 		}
-		sizeBytes, err := readNBytes(conn, 4)
+	}
+	bin := a.binProcessor
+	maxMessageSize := a.maxMessageSize
+	var hello []byte
+	if a.hello {
+		negotiatedBin, n, transcript, err := helloServer(conn, a.timeout, bin, a.maxMessageSize)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to read header bytes")
-			opsTcpErrorCount.Inc()
-			break
-		}
-		bodyLength := getUInt32FromBytes(sizeBytes)
-		if bodyLength == 0 {
-			log.Error().Msg("failed to convert header to len")
+			log.Error().Err(err).Msg("hello failed")
 			opsTcpErrorCount.Inc()
-			break
+			return
 		}
-		if bodyLength > MaxBodySize {
-			log.Error().Uint32("body-length", bodyLength).Msg("body too big")
-			opsTcpErrorCount.Inc()
-			break
+		bin, maxMessageSize, hello = negotiatedBin, n.MaxMessageSize, transcript
+	}
+	if a.handshake != nil {
+		key, err := a.handshake.server(conn, a.timeout, hello)
+		if err == nil {
+			bin, err = sessionBinProcessor(bin, key)
 		}
-
-		err = conn.SetReadDeadline(time.Now().Add(a.timeout))
 		if err != nil {
-			log.Error().Err(err).Msg("fail to set body read deadline")
+			log.Error().Err(err).Msg("handshake failed")
 			opsTcpErrorCount.Inc()
-			break
+			return
 		}
-		dataBytes, err := readNBytes(conn, int(bodyLength))
-		if err != nil {
-			log.Error().Err(err).Msg("failed to read body bytes")
+	}
+	axConn := newAxTcpConnection(a.ctx, a.logger, conn, newOutQueue(a.writeBufSize, a.backpressure, a.backpressureTimeout))
+	axConn.binProcessor = bin
+	axConn.writeTimeout = a.writeTimeout
+	axConn.start()
+	defer axConn.Close()
+	a.conns.add(axConn)
+	defer a.conns.remove(axConn)
+	if a.draining.Load() {
+		axConn.stopReading()
+	}
+	handler := intercept(a.interceptors, a.handlerFunc, axConn.peer)
+	var connLimiter *rate.Limiter
+	if a.rateLimiter != nil {
+		connLimiter = a.rateLimiter.connLimiter()
+	}
+	dispatch := newDispatcher(a.dispatchMode, a.orderingKey)
+	slots := []limitSlot{
+		{"in_flight", newSemaphore(a.limits.MaxInFlight)},
+		{"workers", a.workerSem},
+	}
+	var handlers sync.WaitGroup
+	defer func() {
+		if !axConn.isDraining() {
+			return
+		}
+		handlers.Wait()
+		if err := axConn.flush(); err != nil {
+			log.Warn().Err(err).Msg("flush failed")
+		}
+	}()
+	chunks := newChunkAssembler(maxMessageSize)
+	for {
+		dataBytes, control, err := readFrame(axConn, a.timeout, a.timeout)
+		if err != nil && axConn.isDraining() {
+			break
+		} else if err != nil {
+			log.Error().Err(err).Msg("failed to read frame")
 			opsTcpErrorCount.Inc()
 			break
 		}
-		data, err := a.binProcessor.Unmarshal(dataBytes)
+		if control {
+			c, err := unmarshalControl(dataBytes)
+			if err != nil {
+				log.Error().Err(err).Msg("unmarshal control frame failed")
+				opsTcpErrorCount.Inc()
+				return
+			}
+			switch c.Type {
+			case protobuf.PControlType_P_CONTROL_CHUNK:
+				if dataBytes, err = chunks.add(c.Chunk); err != nil {
+					log.Error().Err(err).Msg("chunk failed")
+					opsTcpErrorCount.Inc()
+					return
+				}
+				if dataBytes == nil {
+					continue
+				}
+			case protobuf.PControlType_P_CONTROL_PING:
+				err = axConn.writeControl(&protobuf.PControl{Type: protobuf.PControlType_P_CONTROL_PONG, Timestamp: c.Timestamp})
+				if err != nil {
+					log.Warn().Err(err).Msg("write pong failed")
+				}
+				continue
+			default:
+				log.Warn().Str("type", c.Type.String()).Msg("unexpected control frame")
+				continue
+			}
+		}
+		// take the token before decrypting, a flood should not cost AES work
+		var rateErr error
+		if a.rateLimiter != nil {
+			if _, rateErr = a.rateLimiter.take(axConn.ctx, "tcp", connLimiter, axConn.peer.RemoteAddr); rateErr != nil && a.rateLimiter.Action() != RateLimitReject {
+				log.Warn().Err(rateErr).Msg("rate limit exceeded")
+				break
+			}
+		}
+		pck, err := unmarshalPacket(axConn.binProcessor, dataBytes)
 		if err != nil {
 			log.Error().Err(err).Msg("unmarshal failed")
 			opsTcpErrorCount.Inc()
 			break
 		}
-		go func(rData []byte) {
+		if rateErr != nil {
+			// the error reply needs the request id
+			if err = axConn.writeError(pck.RequestId, protobuf.PErrorCode_P_ERROR_RATE_LIMITED, rateErr); err != nil {
+				log.Warn().Err(err).Msg("write rate limit error failed")
+			}
+			continue
+		}
+		if err = acquireSlots(axConn.ctx, a.limits.Action, slots...); err != nil {
+			if axConn.ctx.Err() != nil {
+				break
+			}
+			if err = axConn.writeError(pck.RequestId, protobuf.PErrorCode_P_ERROR_OVERLOADED, err); err != nil {
+				log.Warn().Err(err).Msg("write overloaded error failed")
+			}
+			continue
+		}
+		handlers.Add(1)
+		opsInFlightCount.Inc()
+		dispatch.dispatch(pck.Payload, func() {
+			defer handlers.Done()
+			defer opsInFlightCount.Dec()
+			defer releaseSlots(slots...)
 			startTime := time.Now()
-			rData, err = a.handlerFunc(rData, axConn.ctx)
+			rData, err := handler(pck.Payload, axConn.ctx)
 			opsRequestDuration.WithLabelValues("tcp").Observe(time.Since(startTime).Seconds())
 			if err != nil {
 				log.Error().Err(err).Msg("handle request failed")
 				axConn.Close()
 				return
 			}
-			rData, err = a.binProcessor.Marshal(rData)
+			rData, err = marshalPacket(axConn.binProcessor, &protobuf.PPacket{Payload: rData, RequestId: pck.RequestId, Version: pck.Version})
 			if err != nil {
 				log.Error().Err(err).Msg("marshal failed")
 				axConn.Close()
 				return
 			}
-			axConn.Write(rData)
-		}(data)
+			if err = axConn.Write(rData); err != nil {
+				log.Warn().Err(err).Msg("write response failed")
+			}
+		})
 	}
 }
 
-func readNBytes(conn net.Conn, n int) ([]byte, error) {
+func readNBytes(conn io.Reader, n int) ([]byte, error) {
 	buff := make([]byte, n)
 	nRead, err := io.ReadFull(conn, buff)
 	if err != nil {
@@ -2,30 +2,80 @@ package axtransport
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/axgrid/axtransport/protobuf"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
 
+var (
+	ErrNotConnected          = errors.New("not connected")
+	ErrRequestIdNotSupported = errors.New("bin processor does not support request ids")
+	ErrHeartbeatTimeout      = errors.New("server does not answer pings")
+	ErrRequestInHandler      = errors.New("request from a sequential handler can't get its reply")
+)
+
+// readLoopKey marks the context of handlers running on the read loop.
+type readLoopKey struct{}
+
 type AxTcpClient struct {
-	conn         net.Conn
-	address      string
-	ctx          context.Context
-	cancel       context.CancelFunc
-	binProcessor BinProcessor
-	logger       zerolog.Logger
-	timeout      time.Duration
-	handlerFunc  DataReceiveFunc
+	mu             sync.Mutex
+	conn           net.Conn
+	connCtx        context.Context
+	connBin        BinProcessor
+	address        string
+	ctx            context.Context
+	cancel         context.CancelFunc
+	binProcessor   BinProcessor
+	logger         zerolog.Logger
+	timeout        time.Duration
+	maxMessageSize int
+	handlerFunc    DataReceiveFunc
+	dispatchMode   DispatchMode
+	orderingKey    OrderingKeyFunc
+	tlsConfig      *tls.Config
+	pins           [][]byte
+	secret         []byte
+	handshake      *Handshake
+	hello          bool
+	negotiated     *Negotiated
+	requestIdSeq   atomic.Uint64
+	heartbeat      time.Duration
+	maxMissedPongs int32
+	missedPongs    atomic.Int32
+	latency        atomic.Int64
+	reconnect      *Backoff
+	stopReconnect  context.CancelFunc
+	offline        []*protobuf.PPacket
+	offlineSize    int
+	onConnected    func()
+	onDisconnected func(err error)
+	endpoints      *endpointPool
+	pendingMu      sync.Mutex
+	pending        map[uint64]chan requestReply
+}
+
+type requestReply struct {
+	data []byte
+	err  error
 }
 
 func NewAxTcpClient(address string, secret []byte, ctx context.Context, logger zerolog.Logger) (*AxTcpClient, error) {
 	res := &AxTcpClient{
-		logger:  logger,
-		address: address,
-		ctx:     ctx,
-		timeout: time.Second * 5,
+		logger:         logger,
+		address:        address,
+		ctx:            ctx,
+		timeout:        time.Second * 5,
+		maxMessageSize: MaxMessageSize,
+		secret:         secret,
+		pending:        make(map[uint64]chan requestReply),
+		dispatchMode:   DispatchSequential,
+		maxMissedPongs: 3,
 	}
 	res.binProcessor = NewAxBinProcessor(logger)
 	if secret != nil {
@@ -46,6 +96,78 @@ func (a *AxTcpClient) SetTimeout(timeout time.Duration) {
 	a.timeout = timeout
 }
 
+func (a *AxTcpClient) SetMaxMessageSize(size int) {
+	a.maxMessageSize = size
+}
+
+func (a *AxTcpClient) SetTLS(config *tls.Config) {
+	a.tlsConfig = config
+}
+
+func (a *AxTcpClient) SetPinnedCertificates(pins ...[]byte) {
+	a.pins = pins
+}
+
+// SetHandshake enables the session key handshake. A handshake without a
+// secret is authenticated by the client AES secret, next to the server
+// public key if one is set.
+func (a *AxTcpClient) SetHandshake(handshake *Handshake) {
+	if handshake != nil && handshake.Secret == nil {
+		h := *handshake
+		h.Secret = a.secret
+		handshake = &h
+	}
+	a.handshake = handshake
+}
+
+// SetHello starts every connection with a hello frame, the server must
+// have it enabled too.
+func (a *AxTcpClient) SetHello(enabled bool) {
+	a.hello = enabled
+}
+
+// Negotiated returns the configuration agreed on by the last hello.
+func (a *AxTcpClient) Negotiated() (Negotiated, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.negotiated == nil {
+		return Negotiated{}, false
+	}
+	return *a.negotiated, true
+}
+
+// SetResolver makes the client connect to the endpoints of resolver in the
+// order of policy. An endpoint that fails is tried last until cooldown
+// passes.
+func (a *AxTcpClient) SetResolver(resolver Resolver, policy EndpointPolicy, cooldown time.Duration) {
+	a.endpoints = newEndpointPool(resolver, policy, cooldown)
+}
+
+// SetHeartbeat makes the client ping the server every interval and drop the
+// connection when maxMissed pings in a row stay unanswered. A zero interval
+// disables it.
+func (a *AxTcpClient) SetHeartbeat(interval time.Duration, maxMissed int) {
+	a.heartbeat = interval
+	if maxMissed > 0 {
+		a.maxMissedPongs = int32(maxMissed)
+	}
+}
+
+// Latency is the round trip time of the last answered ping.
+func (a *AxTcpClient) Latency() time.Duration {
+	return time.Duration(a.latency.Load())
+}
+
+// SetDispatchMode sets the order of handler calls, the default is
+// DispatchSequential, which calls the handler on the read loop. key is
+// required by DispatchKeyed. Queued messages are dropped with the connection.
+// A sequential handler can't wait for a Request, the reply is read by the
+// loop it blocks; Request called with its ctx fails with ErrRequestInHandler.
+func (a *AxTcpClient) SetDispatchMode(mode DispatchMode, key OrderingKeyFunc) {
+	a.dispatchMode = mode
+	a.orderingKey = key
+}
+
 func (a *AxTcpClient) SetHandler(handler DataReceiveFunc) {
 	if handler == nil {
 		a.handlerFunc = func(data []byte, ctx context.Context) error { return nil }
@@ -55,114 +177,387 @@ func (a *AxTcpClient) SetHandler(handler DataReceiveFunc) {
 }
 
 func (a *AxTcpClient) Disconnect() error {
-	if a.conn == nil {
+	a.mu.Lock()
+	if a.stopReconnect != nil {
+		a.stopReconnect()
+		a.stopReconnect = nil
+	}
+	conn := a.conn
+	err := a.disconnect(conn)
+	a.mu.Unlock()
+	if conn != nil && a.onDisconnected != nil {
+		a.onDisconnected(nil)
+	}
+	return err
+}
+
+func (a *AxTcpClient) disconnect(conn net.Conn) error {
+	if a.conn == nil || a.conn != conn {
 		return nil // already disconnected
 	}
-	err := a.conn.Close()
 	a.conn = nil
-	if err != nil {
+	a.cancel()
+	return conn.Close()
+}
+
+func (a *AxTcpClient) Connect() error {
+	return a.connectContext(context.Background())
+}
+
+// connectContext gives up when ctx is done, the reconnect loop uses it to
+// stop after Disconnect.
+func (a *AxTcpClient) connectContext(ctx context.Context) error {
+	connected, err := a.connect(ctx)
+	if err != nil || !connected {
 		return err
 	}
-	a.cancel()
+	a.flushOffline()
+	if a.onConnected != nil {
+		a.onConnected()
+	}
 	return nil
 }
 
-func (a *AxTcpClient) Connect() error {
+func (a *AxTcpClient) connect(ctx context.Context) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.conn != nil {
-		return nil // already connected
+		return false, nil // already connected
 	}
 	if a.handlerFunc == nil {
-		return errors.New("handler func is nil")
+		return false, errors.New("handler func is nil")
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
 	}
 
-	conn, err := net.Dial("tcp", a.address)
+	conn, err := a.dial()
 	if err != nil {
-		return err
+		return false, err
 	}
-	a.conn = conn
-	subCtx, cancel := context.WithCancel(context.WithValue(a.ctx, "remote_address", conn.RemoteAddr()))
-	a.cancel = cancel
-	go a.readLoop(subCtx)
-	return nil
+	bin := a.binProcessor
+	maxMessageSize := a.maxMessageSize
+	var hello []byte
+	if a.hello {
+		negotiatedBin, n, transcript, err := helloClient(conn, a.timeout, bin, a.maxMessageSize)
+		if err != nil {
+			_ = conn.Close()
+			return false, err
+		}
+		bin, maxMessageSize, a.negotiated, hello = negotiatedBin, n.MaxMessageSize, &n, transcript
+	}
+	if a.handshake != nil {
+		key, err := a.handshake.client(conn, a.timeout, hello)
+		if err == nil {
+			bin, err = sessionBinProcessor(bin, key)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return false, err
+		}
+	}
+	a.conn, a.connBin = conn, bin
+	subCtx, cancel := context.WithCancel(withPeer(a.ctx, connPeer("tcp", conn, 0)))
+	a.connCtx, a.cancel = subCtx, cancel
+	go a.readLoop(subCtx, conn, bin, maxMessageSize)
+	if a.heartbeat > 0 {
+		a.missedPongs.Store(0)
+		go a.heartbeatLoop(subCtx, conn)
+	}
+	return true, nil
 }
 
-func (a *AxTcpClient) readLoop(ctx context.Context) {
+func (a *AxTcpClient) heartbeatLoop(ctx context.Context, conn net.Conn) {
+	ticker := time.NewTicker(a.heartbeat)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			sizeBytes, err := readNBytes(a.conn, 4)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("failed to read header bytes")
-				_ = a.Disconnect()
+		case <-ticker.C:
+			if a.missedPongs.Load() >= a.maxMissedPongs {
+				a.logger.Warn().Int32("missed", a.missedPongs.Load()).Msg("server does not answer pings")
+				if a.endpoints != nil {
+					a.endpoints.markDown(a.Address())
+				}
+				a.dropConn(conn, ErrHeartbeatTimeout)
 				return
 			}
-			if len(sizeBytes) < 4 {
-				a.logger.Error().Msg("invalid size bytes received")
-				_ = a.Disconnect()
+			a.missedPongs.Add(1)
+			if err := a.ping(conn); err != nil {
+				a.logger.Warn().Err(err).Msg("ping failed")
+				a.dropConn(conn, err)
 				return
 			}
-			bodyLength := getUInt32FromBytes(sizeBytes)
-			if bodyLength == 0 {
-				a.logger.Error().Msg("failed to convert header to len")
-				_ = a.Disconnect()
-				break
-			}
-			if bodyLength > MaxBodySize {
-				a.logger.Error().Uint32("body-length", bodyLength).Msg("body too big")
-				_ = a.Disconnect()
-				break
-			}
-			if err = a.conn.SetReadDeadline(time.Now().Add(a.timeout)); err != nil {
-				a.logger.Error().Err(err).Msg("failed to set body read deadline")
-				_ = a.Disconnect()
-				return
-			}
-			dataBytes, err := readNBytes(a.conn, int(bodyLength))
+		}
+	}
+}
+
+func (a *AxTcpClient) ping(conn net.Conn) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != conn {
+		return ErrNotConnected
+	}
+	return writeControl(conn, a.timeout, &protobuf.PControl{
+		Type:      protobuf.PControlType_P_CONTROL_PING,
+		Timestamp: time.Now().UnixNano(),
+	})
+}
+
+func (a *AxTcpClient) dial() (net.Conn, error) {
+	if a.endpoints == nil {
+		return a.dialAddress(a.address)
+	}
+	endpoints, err := a.endpoints.candidates()
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, endpoint := range endpoints {
+		startTime := time.Now()
+		conn, err := a.dialAddress(endpoint)
+		if err != nil {
+			a.logger.Warn().Err(err).Str("endpoint", endpoint).Msg("connect failed")
+			a.endpoints.markDown(endpoint)
+			lastErr = err
+			continue
+		}
+		a.endpoints.observe(endpoint, time.Since(startTime))
+		a.address = endpoint
+		return conn, nil
+	}
+	return nil, errors.Wrapf(lastErr, "all %d endpoints failed", len(endpoints))
+}
+
+func (a *AxTcpClient) dialAddress(address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: a.timeout}
+	if a.tlsConfig == nil && len(a.pins) == 0 {
+		return dialer.Dial("tcp", address)
+	}
+	return tls.DialWithDialer(dialer, "tcp", address, pinnedTLSConfig(a.tlsConfig, a.pins))
+}
+
+// Address is the endpoint of the current or last connection.
+func (a *AxTcpClient) Address() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.address
+}
+
+// dropConn closes a failed connection and starts reconnecting if enabled.
+func (a *AxTcpClient) dropConn(conn net.Conn, err error) {
+	a.mu.Lock()
+	dropped := conn != nil && a.conn == conn
+	_ = a.disconnect(conn)
+	var reconnectCtx context.Context
+	if dropped && a.reconnect != nil && a.ctx.Err() == nil {
+		reconnectCtx, a.stopReconnect = context.WithCancel(a.ctx)
+	}
+	a.mu.Unlock()
+	if !dropped {
+		return
+	}
+	if a.onDisconnected != nil {
+		a.onDisconnected(err)
+	}
+	if reconnectCtx != nil {
+		go a.reconnectLoop(reconnectCtx)
+	}
+}
+
+func (a *AxTcpClient) readLoop(ctx context.Context, conn net.Conn, bin BinProcessor, maxMessageSize int) {
+	chunks := newChunkAssembler(maxMessageSize)
+	dispatch := newDispatcher(a.dispatchMode, a.orderingKey)
+	defer dispatch.stop()
+	handlerCtx := context.WithValue(ctx, readLoopKey{}, true)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			dataBytes, control, err := readFrame(conn, 0, a.timeout)
 			if err != nil {
-				a.logger.Error().Err(err).Msg("failed to read body bytes")
-				_ = a.Disconnect()
+				if ctx.Err() == nil {
+					a.logger.Error().Err(err).Msg("failed to read frame")
+				}
+				a.dropConn(conn, err)
 				return
 			}
-			inData, err := a.binProcessor.Unmarshal(dataBytes)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("unmarshal failed")
-				_ = a.Disconnect()
-				break
+			if control {
+				c, err := unmarshalControl(dataBytes)
+				if err != nil {
+					a.logger.Error().Err(err).Msg("unmarshal control frame failed")
+					a.dropConn(conn, err)
+					return
+				}
+				switch c.Type {
+				case protobuf.PControlType_P_CONTROL_CHUNK:
+					if dataBytes, err = chunks.add(c.Chunk); err != nil {
+						a.logger.Error().Err(err).Msg("chunk failed")
+						a.dropConn(conn, err)
+						return
+					}
+					if dataBytes == nil {
+						continue
+					}
+				case protobuf.PControlType_P_CONTROL_PONG:
+					a.missedPongs.Store(0)
+					a.latency.Store(time.Now().UnixNano() - c.Timestamp)
+					if a.endpoints != nil {
+						a.endpoints.observe(a.Address(), a.Latency())
+					}
+					continue
+				case protobuf.PControlType_P_CONTROL_ERROR:
+					err = &RemoteError{Code: c.Error.GetCode(), Message: c.Error.GetMessage()}
+					if !a.resolve(c.RequestId, requestReply{err: err}) {
+						a.logger.Warn().Err(err).Msg("error from server")
+					}
+					continue
+				default:
+					a.logger.Warn().Str("type", c.Type.String()).Msg("unexpected control frame")
+					continue
+				}
 			}
-			err = a.handlerFunc(inData, a.ctx)
+			pck, err := unmarshalPacket(bin, dataBytes)
 			if err != nil {
-				a.logger.Error().Err(err).Msg("handle request failed")
-				_ = a.Disconnect()
+				a.logger.Error().Err(err).Msg("unmarshal failed")
+				a.dropConn(conn, err)
 				return
 			}
+			if a.resolve(pck.RequestId, requestReply{data: pck.Payload}) {
+				continue
+			}
+			// sequential messages run on the read loop, a slow handler
+			// stops reading instead of queueing
+			if dispatch.mode == DispatchSequential {
+				if err = a.handlerFunc(pck.Payload, handlerCtx); err != nil {
+					a.logger.Error().Err(err).Msg("handle request failed")
+					a.dropConn(conn, err)
+					return
+				}
+				continue
+			}
+			dispatch.dispatch(pck.Payload, func() {
+				if ctx.Err() != nil {
+					return // the connection was dropped
+				}
+				if err := a.handlerFunc(pck.Payload, ctx); err != nil {
+					a.logger.Error().Err(err).Msg("handle request failed")
+					a.dropConn(conn, err)
+				}
+			})
 		}
 	}
 }
 
+func (a *AxTcpClient) resolve(requestId uint64, reply requestReply) bool {
+	if requestId == 0 {
+		return false
+	}
+	a.pendingMu.Lock()
+	ch, ok := a.pending[requestId]
+	delete(a.pending, requestId)
+	a.pendingMu.Unlock()
+	if ok {
+		ch <- reply
+	} else {
+		a.logger.Debug().Uint64("request-id", requestId).Msg("drop response for abandoned request")
+	}
+	return true
+}
+
 func (a *AxTcpClient) IsConnected() bool {
-	if a.conn == nil {
+	a.mu.Lock()
+	conn := a.conn
+	a.mu.Unlock()
+	if conn == nil {
 		return false
 	}
-	if _, err := a.conn.Write([]byte{}); err != nil {
+	if _, err := conn.Write([]byte{}); err != nil {
 		return false
 	}
 	return true
 }
 
+// Send pushes data to the server. With reconnect enabled data sent while
+// disconnected is queued until the connection is back.
 func (a *AxTcpClient) Send(in []byte) error {
+	pck := &protobuf.PPacket{Payload: in}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// keep the order of queued data
+	if a.reconnect != nil && (a.conn == nil || len(a.offline) > 0) {
+		return a.enqueueOffline(pck)
+	}
+	return a.sendLocked(pck)
+}
 
-	inBts, err := a.binProcessor.Marshal(in)
-	if err != nil {
-		return err
+// Request sends data and waits for the response carrying the same request id.
+// It must not be called from a DispatchSequential handler: with the handler
+// ctx it fails with ErrRequestInHandler, with another ctx it blocks until
+// that ctx is done.
+func (a *AxTcpClient) Request(ctx context.Context, in []byte) ([]byte, error) {
+	if ctx.Value(readLoopKey{}) != nil {
+		return nil, ErrRequestInHandler
 	}
-	if err = a.conn.SetWriteDeadline(time.Now().Add(a.timeout)); err != nil {
+	if _, ok := a.binProcessor.(PacketProcessor); !ok {
+		return nil, ErrRequestIdNotSupported
+	}
+	a.mu.Lock()
+	connCtx := a.connCtx
+	a.mu.Unlock()
+	if connCtx == nil {
+		return nil, ErrNotConnected
+	}
+	requestId := a.requestIdSeq.Add(1)
+	ch := make(chan requestReply, 1)
+	a.pendingMu.Lock()
+	a.pending[requestId] = ch
+	a.pendingMu.Unlock()
+	defer func() {
+		a.pendingMu.Lock()
+		delete(a.pending, requestId)
+		a.pendingMu.Unlock()
+	}()
+	if err := a.send(&protobuf.PPacket{Payload: in, RequestId: requestId}); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-ch:
+		return reply.data, reply.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-connCtx.Done():
+		return nil, ErrNotConnected
+	}
+}
+
+func (a *AxTcpClient) send(pck *protobuf.PPacket) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sendLocked(pck)
+}
+
+func (a *AxTcpClient) sendLocked(pck *protobuf.PPacket) error {
+	if a.conn == nil {
+		return ErrNotConnected
+	}
+	inBts, err := marshalPacket(a.connBin, pck)
+	if err != nil {
 		return err
 	}
-	_, err = a.conn.Write(addSize32(inBts))
+	frames, err := dataFrames(inBts)
 	if err != nil {
 		return err
 	}
+	for _, frame := range frames {
+		if err = a.conn.SetWriteDeadline(time.Now().Add(a.timeout)); err != nil {
+			return err
+		}
+		if _, err = a.conn.Write(frame); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -1 +1,102 @@
 package axtransport
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAxTcp_SendToAndBroadcast(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8091).WithAES(key).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	received := make(chan string, 10)
+	client, err := NewAxTcpClient("localhost:8091", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		received <- string(data)
+		return nil
+	})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	assert.Eventually(t, func() bool { return len(transport.Connections()) == 1 }, time.Second, 10*time.Millisecond)
+	id := transport.Connections()[0]
+
+	require.Nil(t, transport.SendTo(id, []byte("direct")))
+	assert.Equal(t, "direct", waitString(t, received))
+
+	require.Nil(t, transport.Broadcast([]byte("everyone")))
+	assert.Equal(t, "everyone", waitString(t, received))
+
+	assert.ErrorIs(t, transport.SendTo(id+1000, []byte("nobody")), ErrConnectionNotFound)
+}
+
+func waitString(t *testing.T, ch chan string) string {
+	t.Helper()
+	select {
+	case s := <-ch:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for data")
+		return ""
+	}
+}
+
+func TestAxTcpClient_Request(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		// later requests answer first to make responses arrive out of order
+		delay, _ := time.ParseDuration(string(d))
+		time.Sleep(delay)
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8092).WithAES(key).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	pushes := make(chan string, 10)
+	client, err := NewAxTcpClient("localhost:8092", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		pushes <- string(data)
+		return nil
+	})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	delays := []string{"300ms", "200ms", "100ms", "0s"}
+	results := make(chan [2]string, len(delays))
+	for _, d := range delays {
+		go func(d string) {
+			res, err := client.Request(context.Background(), []byte(d))
+			assert.Nil(t, err)
+			results <- [2]string{d, string(res)}
+		}(d)
+	}
+	for range delays {
+		select {
+		case r := <-results:
+			assert.Equal(t, r[0], r[1])
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for response")
+		}
+	}
+
+	require.Eventually(t, func() bool { return len(transport.Connections()) == 1 }, time.Second, 10*time.Millisecond)
+	require.Nil(t, transport.SendTo(transport.Connections()[0], []byte("push")))
+	assert.Equal(t, "push", waitString(t, pushes))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Request(ctx, []byte("1s"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,15 +1,24 @@
 package axtransport
 
-import "github.com/go-chi/chi/v5"
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"sort"
+	"sync"
+)
 
 type Transport struct {
 	b    *Builder
 	tcp  *AxTcp
 	http *AxHttp
+	ws   *AxWebSocket
 }
 
 func (t *Transport) Start() error {
-	t.StartHTTP()
+	if err := t.StartHTTP(); err != nil {
+		return err
+	}
 	return t.StartTCP()
 }
 
@@ -23,10 +32,14 @@ func (t *Transport) StartTCP() error {
 	return nil
 }
 
-func (t *Transport) StartHTTP() {
+func (t *Transport) StartHTTP() error {
+	if t.ws != nil {
+		t.ws.Start()
+	}
 	if t.http != nil {
-		t.http.Start()
+		return t.http.Start()
 	}
+	return nil
 }
 
 func (t *Transport) Stop() {
@@ -35,6 +48,9 @@ func (t *Transport) Stop() {
 }
 
 func (t *Transport) StopHTTP() {
+	if t.ws != nil {
+		t.ws.Stop()
+	}
 	if t.http != nil {
 		t.http.Stop()
 	}
@@ -46,6 +62,77 @@ func (t *Transport) StopTCP() {
 	}
 }
 
+// Shutdown stops accepting connections and requests and waits until
+// in-flight requests are handled and their replies are written, or ctx is
+// done. WebSocket connections are closed once HTTP and TCP have drained.
+func (t *Transport) Shutdown(ctx context.Context) error {
+	var wg sync.WaitGroup
+	var httpErr, tcpErr error
+	if t.http != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			httpErr = t.http.Shutdown(ctx)
+		}()
+	}
+	if t.tcp != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tcpErr = t.tcp.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	if t.ws != nil {
+		t.ws.Stop()
+	}
+	return errors.Join(httpErr, tcpErr)
+}
+
 func (t *Transport) Router() chi.Router {
 	return t.http.parentRouter
 }
+
+func (t *Transport) Connections() []uint64 {
+	var res []uint64
+	if t.tcp != nil {
+		res = append(res, t.tcp.Connections()...)
+	}
+	if t.ws != nil {
+		res = append(res, t.ws.Connections()...)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+func (t *Transport) SendTo(id uint64, data []byte) error {
+	if t.tcp != nil {
+		if _, ok := t.tcp.Connection(id); ok {
+			return t.tcp.SendTo(id, data)
+		}
+	}
+	if t.ws != nil {
+		if _, ok := t.ws.Connection(id); ok {
+			return t.ws.SendTo(id, data)
+		}
+	}
+	return ErrConnectionNotFound
+}
+
+func (t *Transport) Broadcast(data []byte) error {
+	var errs []error
+	if t.tcp != nil {
+		errs = append(errs, t.tcp.Broadcast(data))
+	}
+	if t.ws != nil {
+		errs = append(errs, t.ws.Broadcast(data))
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Transport) SendToSession(session string, data []byte) error {
+	if t.http == nil {
+		return ErrNoSession
+	}
+	return t.http.SendToSession(session, data)
+}
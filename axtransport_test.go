@@ -2,9 +2,14 @@ package axtransport
 
 import (
 	"context"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestAxTransportHttpRequest(t *testing.T) {
@@ -25,3 +30,138 @@ func TestAxTransportHttpRequest(t *testing.T) {
 	assert.Equal(t, "test-string", string(data))
 
 }
+
+func TestAxTransportHttpEvents(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	sessions := make(chan string, 1)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		peer, _ := PeerFromContext(ctx)
+		sessions <- peer.Session
+		return d, nil
+	}
+	transport := AxTransport().WithHTTPServer("", 8082).WithHTTPEventTimeout(200 * time.Millisecond).WithAES(key).WithDataHandlerFunc(f).Build()
+	assert.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client := NewAxHttpClient(key)
+	_, err := client.Post("http://localhost:8082/api", []byte("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, client.Session(), <-sessions)
+
+	received := make(chan string, 10)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		received <- string(data)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.PollEvents(ctx, "http://localhost:8082/api/events") }()
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Nil(t, transport.SendToSession(client.Session(), []byte("event-1")))
+	assert.Nil(t, transport.SendToSession(client.Session(), []byte("event-2")))
+	for _, expected := range []string{"event-1", "event-2"} {
+		select {
+		case data := <-received:
+			assert.Equal(t, expected, data)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestAxTransportHttpSessionLimit(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithHTTPServer("", 8113).WithHTTPEventTimeout(50*time.Millisecond).WithHTTPMaxSessions(10, 1).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	poll := func(session string) int {
+		req, err := http.NewRequest("GET", "http://localhost:8113/api/events", nil)
+		require.Nil(t, err)
+		req.Header.Set(SessionHeader, session)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	// polling does not create sessions
+	assert.Equal(t, http.StatusNotFound, poll("never-posted"))
+	assert.ErrorIs(t, transport.SendToSession("never-posted", []byte("event")), ErrNoSession)
+
+	client := NewAxHttpClient(nil)
+	client.SetSession("first")
+	_, err := client.Post("http://localhost:8113/api", []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, poll("first"))
+	assert.Nil(t, transport.SendToSession("first", []byte("event")))
+
+	// a session is polled only from the IP that sent its requests
+	require.Nil(t, transport.http.bindSession("foreign", "10.0.0.1"))
+	assert.Equal(t, http.StatusForbidden, poll("foreign"))
+
+	// one session per IP
+	client.SetSession("second")
+	_, err = client.Post("http://localhost:8113/api", []byte("hello"))
+	assert.ErrorContains(t, err, "503")
+}
+
+func TestTransport_ShutdownNotStarted(t *testing.T) {
+	transport := AxTransport().WithHTTPServer("localhost", 8119).WithTCPServer("localhost", 8120).WithDataHandlerFunc(func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}).Build()
+	require.Nil(t, transport.StartHTTP())
+	assert.Nil(t, transport.Shutdown(context.Background()))
+}
+
+func TestTransport_Shutdown(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	started := make(chan struct{}, 2)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		started <- struct{}{}
+		time.Sleep(300 * time.Millisecond)
+		return d, nil
+	}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8085).
+		WithTCPServer("localhost", 8097).
+		WithAES(key).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	tcpClient, err := NewAxTcpClient("localhost:8097", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	tcpClient.SetHandler(nil)
+	require.Nil(t, tcpClient.Connect())
+	defer tcpClient.Disconnect()
+
+	results := make(chan string, 2)
+	go func() {
+		res, err := tcpClient.Request(context.Background(), []byte("tcp"))
+		assert.Nil(t, err)
+		results <- string(res)
+	}()
+	go func() {
+		res, err := NewAxHttpClient(key).Post("http://localhost:8085/api", []byte("http"))
+		assert.Nil(t, err)
+		results <- string(res)
+	}()
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Nil(t, transport.Shutdown(ctx))
+	got := []string{<-results, <-results}
+	assert.ElementsMatch(t, []string{"tcp", "http"}, got)
+	assert.Empty(t, transport.Connections())
+
+	_, err = net.DialTimeout("tcp", "localhost:8097", time.Second)
+	assert.NotNil(t, err)
+}
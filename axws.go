@@ -0,0 +1,323 @@
+package axtransport
+
+import (
+	"context"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+	"net"
+	"net/http"
+	"time"
+)
+
+var (
+	opsWsConnectionsCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ax_transport",
+		Name:      "ws_connections",
+		Help:      "WebSocket connections",
+	})
+
+	opsWsErrorCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ax_transport",
+		Name:      "ws_error_count",
+		Help:      "WebSocket error count",
+	})
+)
+
+type AxWebSocket struct {
+	logger         zerolog.Logger
+	parentCtx      context.Context
+	ctx            context.Context
+	cancelFn       context.CancelFunc
+	timeout        time.Duration
+	path           string
+	writeBufSize   int
+	maxMessageSize int
+	upgrader       websocket.Upgrader
+	binProcessor   BinProcessor
+	handlerFunc    DataHandlerFunc
+	interceptors   []Interceptor
+	rateLimiter    *RateLimiter
+	limits         ConcurrencyLimits
+	connSem        semaphore
+	workerSem      semaphore
+	conns          *connRegistry[*AxWsConnection]
+}
+
+type AxWsConnection struct {
+	id       uint64
+	logger   zerolog.Logger
+	conn     *websocket.Conn
+	outSize  int
+	outChan  chan []byte
+	ctx      context.Context
+	cancelFn context.CancelFunc
+	peer     *Peer
+}
+
+func NewAxWsConnection(ctx context.Context, logger zerolog.Logger, conn *websocket.Conn, outSize int) *AxWsConnection {
+	res := &AxWsConnection{
+		id:      connectionIdSeq.Add(1),
+		logger:  logger,
+		conn:    conn,
+		outSize: outSize,
+		outChan: make(chan []byte, outSize),
+	}
+	res.peer = connPeer("ws", conn.UnderlyingConn(), res.id)
+	res.ctx, res.cancelFn = context.WithCancel(withPeer(ctx, res.peer))
+	go func() {
+		defer conn.Close()
+		for {
+			select {
+			case <-res.ctx.Done():
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			case data := <-res.outChan:
+				if err := conn.SetWriteDeadline(time.Now().Add(time.Second * 5)); err != nil {
+					res.logger.Error().Err(err).Msg("can't set write deadline to connection")
+				}
+				if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+					res.logger.Error().Err(err).Msg("can't write to connection")
+					opsWsErrorCount.Inc()
+					res.cancelFn()
+					return
+				}
+			}
+		}
+	}()
+	return res
+}
+
+func (a *AxWsConnection) ID() uint64 {
+	return a.id
+}
+
+func (a *AxWsConnection) Close() {
+	a.cancelFn()
+}
+
+func (a *AxWsConnection) Write(data []byte) error {
+	if len(a.outChan) > a.outSize/2 {
+		a.logger.Error().Err(a.ctx.Err()).Msg("too much data in out chan")
+		return ErrTooMuchData
+	}
+	if a.ctx.Err() != nil {
+		a.logger.Error().Err(a.ctx.Err()).Msg("can't write to connection out chan")
+		opsWsErrorCount.Inc()
+		return a.ctx.Err()
+	}
+	select {
+	case <-a.ctx.Done():
+		return a.ctx.Err()
+	case a.outChan <- data:
+		return nil
+	}
+}
+
+func (a *AxWsConnection) RemoteAddr() net.Addr {
+	return a.conn.RemoteAddr()
+}
+
+func NewAxWebSocket(ctx context.Context, logger zerolog.Logger, path string, writeBufSize int, bin BinProcessor, handlerFunc DataHandlerFunc) *AxWebSocket {
+	return &AxWebSocket{
+		logger:         logger,
+		parentCtx:      ctx,
+		timeout:        30 * time.Second,
+		path:           path,
+		writeBufSize:   writeBufSize,
+		maxMessageSize: MaxMessageSize,
+		binProcessor:   bin,
+		handlerFunc:    handlerFunc,
+		conns:          newConnRegistry[*AxWsConnection](),
+	}
+}
+
+func (a *AxWebSocket) WithTimeout(timeout time.Duration) *AxWebSocket {
+	a.timeout = timeout
+	return a
+}
+
+func (a *AxWebSocket) WithMaxMessageSize(size int) *AxWebSocket {
+	a.maxMessageSize = size
+	return a
+}
+
+func (a *AxWebSocket) WithInterceptors(interceptors ...Interceptor) *AxWebSocket {
+	a.interceptors = append(a.interceptors, interceptors...)
+	return a
+}
+
+// WithRateLimiter limits the messages of every connection, share the limiter
+// with the other transports to apply the same per IP and global buckets.
+func (a *AxWebSocket) WithRateLimiter(limiter *RateLimiter) *AxWebSocket {
+	a.rateLimiter = limiter
+	return a
+}
+
+func (a *AxWebSocket) WithConcurrencyLimits(limits ConcurrencyLimits) *AxWebSocket {
+	a.limits = limits
+	a.connSem = newSemaphore(limits.MaxConnections)
+	a.workerSem = newSemaphore(limits.Workers)
+	return a
+}
+
+func (a *AxWebSocket) WithCheckOrigin(checkOrigin func(r *http.Request) bool) *AxWebSocket {
+	a.upgrader.CheckOrigin = checkOrigin
+	return a
+}
+
+func (a *AxWebSocket) Mount(r chi.Router) *AxWebSocket {
+	r.Get(a.path, a.handler)
+	return a
+}
+
+func (a *AxWebSocket) Start() {
+	a.logger.Debug().Str("path", a.path).Msg("start websocket server")
+	a.ctx, a.cancelFn = context.WithCancel(a.parentCtx)
+}
+
+func (a *AxWebSocket) Stop() {
+	if a.cancelFn != nil {
+		a.cancelFn()
+	}
+}
+
+func (a *AxWebSocket) Connections() []uint64 {
+	return a.conns.ids()
+}
+
+func (a *AxWebSocket) Connection(id uint64) (*AxWsConnection, bool) {
+	return a.conns.get(id)
+}
+
+func (a *AxWebSocket) SendTo(id uint64, data []byte) error {
+	conn, ok := a.conns.get(id)
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	data, err := a.binProcessor.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return conn.Write(data)
+}
+
+func (a *AxWebSocket) Broadcast(data []byte) error {
+	data, err := a.binProcessor.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return a.conns.broadcast(data)
+}
+
+func (a *AxWebSocket) handler(w http.ResponseWriter, r *http.Request) {
+	if a.ctx == nil || a.ctx.Err() != nil {
+		writeHttpErr(w, http.StatusServiceUnavailable, http.ErrServerClosed)
+		return
+	}
+	if err := acquireSlots(r.Context(), a.limits.Action, limitSlot{"connections", a.connSem}); err != nil {
+		a.logger.Warn().Err(err).Str("remote", r.RemoteAddr).Msg("websocket refused")
+		writeHttpErr(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer a.connSem.release()
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("websocket upgrade failed")
+		opsWsErrorCount.Inc()
+		return
+	}
+	a.handleConn(conn, r.Header)
+}
+
+func (a *AxWebSocket) handleConn(conn *websocket.Conn, header http.Header) {
+	log := a.logger.With().Str("remote", conn.RemoteAddr().String()).Logger()
+	opsWsConnectionsCount.Inc()
+	defer opsWsConnectionsCount.Dec()
+	conn.SetReadLimit(int64(a.maxMessageSize))
+	axConn := NewAxWsConnection(a.ctx, a.logger, conn, a.writeBufSize)
+	axConn.peer.Header = header
+	defer axConn.Close()
+	a.conns.add(axConn)
+	defer a.conns.remove(axConn)
+	handler := intercept(a.interceptors, a.handlerFunc, axConn.peer)
+	var connLimiter *rate.Limiter
+	if a.rateLimiter != nil {
+		connLimiter = a.rateLimiter.connLimiter()
+	}
+	slots := []limitSlot{
+		{"in_flight", newSemaphore(a.limits.MaxInFlight)},
+		{"workers", a.workerSem},
+	}
+	go func() {
+		// unblock ReadMessage when the connection or the server is closed
+		<-axConn.ctx.Done()
+		_ = conn.SetReadDeadline(time.Now())
+	}()
+	for {
+		err := conn.SetReadDeadline(time.Now().Add(a.timeout))
+		if err != nil {
+			log.Error().Err(err).Msg("set read deadline failed")
+			opsWsErrorCount.Inc()
+			return
+		}
+		messageType, dataBytes, err := conn.ReadMessage()
+		if err != nil {
+			if axConn.ctx.Err() == nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Error().Err(err).Msg("failed to read message")
+				opsWsErrorCount.Inc()
+			}
+			return
+		}
+		if messageType != websocket.BinaryMessage {
+			log.Error().Int("message-type", messageType).Msg("binary message expected")
+			opsWsErrorCount.Inc()
+			return
+		}
+		if a.rateLimiter != nil {
+			if _, err = a.rateLimiter.take(axConn.ctx, "ws", connLimiter, axConn.peer.RemoteAddr); err != nil {
+				if a.rateLimiter.Action() != RateLimitReject {
+					log.Warn().Err(err).Msg("rate limit exceeded")
+					return
+				}
+				log.Warn().Err(err).Msg("message dropped")
+				continue
+			}
+		}
+		pck, err := unmarshalPacket(a.binProcessor, dataBytes)
+		if err != nil {
+			log.Error().Err(err).Msg("unmarshal failed")
+			opsWsErrorCount.Inc()
+			return
+		}
+		if err = acquireSlots(axConn.ctx, a.limits.Action, slots...); err != nil {
+			if axConn.ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Msg("message dropped")
+			continue
+		}
+		go func(pck *protobuf.PPacket) {
+			defer releaseSlots(slots...)
+			startTime := time.Now()
+			rData, err := handler(pck.Payload, axConn.ctx)
+			opsRequestDuration.WithLabelValues("ws").Observe(time.Since(startTime).Seconds())
+			if err != nil {
+				log.Error().Err(err).Msg("handle request failed")
+				axConn.Close()
+				return
+			}
+			rData, err = marshalPacket(a.binProcessor, &protobuf.PPacket{Payload: rData, RequestId: pck.RequestId, Version: pck.Version})
+			if err != nil {
+				log.Error().Err(err).Msg("marshal failed")
+				axConn.Close()
+				return
+			}
+			_ = axConn.Write(rData)
+		}(pck)
+	}
+}
@@ -0,0 +1,74 @@
+package axtransport
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAxWebSocket_RequestAndPush(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return append([]byte("echo:"), d...), nil
+	}
+	transport := AxTransport().WithHTTPServer("localhost", 8083).WithWebSocket("/ws").WithAES(key).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	bin := NewAxBinProcessor(zerolog.Nop()).WithAES(key)
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8083/ws", nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	read := func() string {
+		require.Nil(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		messageType, data, err := conn.ReadMessage()
+		require.Nil(t, err)
+		assert.Equal(t, websocket.BinaryMessage, messageType)
+		data, err = bin.Unmarshal(data)
+		require.Nil(t, err)
+		return string(data)
+	}
+
+	data, err := bin.Marshal([]byte("hello"))
+	require.Nil(t, err)
+	require.Nil(t, conn.WriteMessage(websocket.BinaryMessage, data))
+	assert.Equal(t, "echo:hello", read())
+
+	require.Len(t, transport.Connections(), 1)
+	require.Nil(t, transport.SendTo(transport.Connections()[0], []byte("push")))
+	assert.Equal(t, "push", read())
+}
+
+func TestAxWebSocket_RateLimit(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8115).
+		WithWebSocket("/ws").
+		WithRateLimit(RateLimits{PerIP: RateLimit{Rate: 0.1, Burst: 1}, Action: RateLimitDisconnect}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	// the POST takes the only token of the IP bucket
+	_, err := NewAxHttpClient(nil).Post("http://localhost:8115/api", []byte("post"))
+	require.Nil(t, err)
+
+	bin := NewAxBinProcessor(zerolog.Nop())
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8115/ws", nil)
+	require.Nil(t, err)
+	defer conn.Close()
+	data, err := bin.Marshal([]byte("ws"))
+	require.Nil(t, err)
+	require.Nil(t, conn.WriteMessage(websocket.BinaryMessage, data))
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected error %v", err)
+}
@@ -0,0 +1,112 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+// BackpressurePolicy decides what a connection does with a message when its
+// out queue is more than half full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureDropNewest rejects the new message with ErrTooMuchData.
+	BackpressureDropNewest BackpressurePolicy = iota
+	// BackpressureDropOldest discards queued messages to make room.
+	BackpressureDropOldest
+	// BackpressureBlock waits for room in the queue until the write context
+	// is done or the backpressure timeout expires.
+	BackpressureBlock
+	// BackpressureDisconnect closes the slow connection.
+	BackpressureDisconnect
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureDropNewest:
+		return "drop_newest"
+	case BackpressureDropOldest:
+		return "drop_oldest"
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+var ErrSlowConsumer = errors.New("connection closed: slow consumer")
+
+var opsBackpressureCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ax_transport",
+	Name:      "backpressure_count",
+	Help:      "Messages affected by backpressure",
+}, []string{"policy"})
+
+// outQueue holds the framed messages waiting for the connection writer.
+// Every entry is one message, possibly split into several frames.
+type outQueue struct {
+	ch      chan [][]byte
+	size    int
+	policy  BackpressurePolicy
+	timeout time.Duration
+}
+
+func newOutQueue(size int, policy BackpressurePolicy, timeout time.Duration) *outQueue {
+	return &outQueue{
+		ch:      make(chan [][]byte, size),
+		size:    size,
+		policy:  policy,
+		timeout: timeout,
+	}
+}
+
+func (q *outQueue) full() bool {
+	return len(q.ch) > q.size/2
+}
+
+// push queues frames. connCtx is the connection lifetime, ctx bounds the wait
+// of BackpressureBlock. closeFn is called by BackpressureDisconnect.
+func (q *outQueue) push(connCtx, ctx context.Context, frames [][]byte, closeFn func()) error {
+	if q.full() {
+		opsBackpressureCount.WithLabelValues(q.policy.String()).Inc()
+		switch q.policy {
+		case BackpressureDropOldest:
+			for q.full() {
+				select {
+				case <-q.ch:
+				default:
+				}
+			}
+		case BackpressureBlock:
+			if q.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, q.timeout)
+				defer cancel()
+			}
+			select {
+			case <-connCtx.Done():
+				return connCtx.Err()
+			case <-ctx.Done():
+				return ErrTooMuchData
+			case q.ch <- frames:
+				return nil
+			}
+		case BackpressureDisconnect:
+			closeFn()
+			return ErrSlowConsumer
+		default:
+			return ErrTooMuchData
+		}
+	}
+	select {
+	case <-connCtx.Done():
+		return connCtx.Err()
+	case q.ch <- frames:
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package axtransport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fillOutQueue(t *testing.T, q *outQueue, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		require.Nil(t, q.push(context.Background(), context.Background(), [][]byte{{byte(i)}}, nil))
+	}
+}
+
+func TestOutQueue_DropNewest(t *testing.T) {
+	q := newOutQueue(4, BackpressureDropNewest, 0)
+	fillOutQueue(t, q, 3)
+	assert.ErrorIs(t, q.push(context.Background(), context.Background(), [][]byte{{9}}, nil), ErrTooMuchData)
+	assert.Equal(t, 3, len(q.ch))
+}
+
+func TestOutQueue_DropOldest(t *testing.T) {
+	q := newOutQueue(4, BackpressureDropOldest, 0)
+	fillOutQueue(t, q, 3)
+	require.Nil(t, q.push(context.Background(), context.Background(), [][]byte{{9}}, nil))
+	var last []byte
+	for len(q.ch) > 0 {
+		last = (<-q.ch)[0]
+	}
+	assert.Equal(t, []byte{9}, last)
+}
+
+func TestOutQueue_Block(t *testing.T) {
+	q := newOutQueue(2, BackpressureBlock, 50*time.Millisecond)
+	fillOutQueue(t, q, 2)
+	start := time.Now()
+	assert.ErrorIs(t, q.push(context.Background(), context.Background(), [][]byte{{9}}, nil), ErrTooMuchData)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-q.ch
+	}()
+	require.Nil(t, q.push(context.Background(), context.Background(), [][]byte{{9}}, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, q.push(context.Background(), ctx, [][]byte{{9}}, nil), ErrTooMuchData)
+}
+
+func TestOutQueue_Disconnect(t *testing.T) {
+	q := newOutQueue(4, BackpressureDisconnect, 0)
+	fillOutQueue(t, q, 3)
+	closed := false
+	err := q.push(context.Background(), context.Background(), [][]byte{{9}}, func() { closed = true })
+	assert.ErrorIs(t, err, ErrSlowConsumer)
+	assert.True(t, closed)
+}
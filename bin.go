@@ -2,10 +2,11 @@ package axtransport
 
 import (
 	"errors"
-	"github.com/axgrid/axtransport/internal"
+	"fmt"
 	"github.com/axgrid/axtransport/protobuf"
 	"github.com/golang/protobuf/proto"
 	"github.com/rs/zerolog"
+	"time"
 )
 
 /*
@@ -24,73 +25,267 @@ type BinProcessor interface {
 	Marshal(in []byte) ([]byte, error)
 }
 
+// PacketProcessor is a BinProcessor that exposes the PPacket envelope, so
+// transports can carry metadata such as request ids next to the payload.
+// MarshalPacket encodes pck.Payload in place.
+type PacketProcessor interface {
+	BinProcessor
+	UnmarshalPacket(in []byte) (*protobuf.PPacket, error)
+	MarshalPacket(pck *protobuf.PPacket) ([]byte, error)
+}
+
 var ErrNoAES = errors.New("no aes")
 
 type AxBinProcessor struct {
 	logger          zerolog.Logger
-	aes             *internal.AES
+	keyring         *Keyring
 	compressionSize int
+	compression     protobuf.PCompression
+	replay          *replayWindow
+	version         uint32
+	minVersion      uint32
+	// requireAES rejects unencrypted packets once AES has been negotiated.
+	requireAES bool
+	// aesErr keeps a rejected WithAES key, packets fail instead of going out
+	// in plain text.
+	aesErr error
 }
 
 func NewAxBinProcessor(logger zerolog.Logger) *AxBinProcessor {
 	return &AxBinProcessor{
-		logger: logger,
+		logger:      logger,
+		compression: protobuf.PCompression_P_COMPRESSION_GZIP,
 	}
 }
 
+// WithAES adds secretKey to the keyring as key 0. It becomes the active key
+// only when the keyring has none yet. An invalid key makes every Marshal and
+// Unmarshal fail with the error.
 func (b *AxBinProcessor) WithAES(secretKey []byte) BinProcessor {
-	b.aes = internal.NewAES(secretKey)
+	if b.keyring == nil {
+		b.keyring = NewKeyring()
+	}
+	if err := b.keyring.Add(0, secretKey); err != nil {
+		b.logger.Error().Err(err).Msg("can't add aes key")
+		b.aesErr = err
+		return b
+	}
+	b.aesErr = nil
+	b.keyring.activateDefault(0)
+	return b
+}
+
+func (b *AxBinProcessor) WithKeyring(keyring *Keyring) *AxBinProcessor {
+	b.keyring = keyring
 	return b
 }
 
+// WithSessionKey returns a copy of the processor that encrypts with key only
+// and rejects unencrypted packets.
+func (b *AxBinProcessor) WithSessionKey(key []byte) BinProcessor {
+	res := *b
+	res.keyring = NewKeyring()
+	res.requireAES = true
+	res.WithAES(key)
+	return &res
+}
+
+func (b *AxBinProcessor) Keyring() *Keyring {
+	return b.keyring
+}
+
 func (b *AxBinProcessor) WithCompressionSize(size int) BinProcessor {
 	b.compressionSize = size
 	return b
 }
 
+func (b *AxBinProcessor) WithCompression(compression protobuf.PCompression) *AxBinProcessor {
+	b.compression = compression
+	return b
+}
+
+// WithReplayProtection stamps outgoing packets with a timestamp and a nonce
+// and rejects incoming packets that are older than skew or already seen.
+func (b *AxBinProcessor) WithReplayProtection(skew time.Duration) *AxBinProcessor {
+	b.replay = newReplayWindow(skew)
+	return b
+}
+
+// WithPacketVersion sets the lowest version of outgoing packets. Replies
+// keep the version of the request, so a server can stay on
+// PacketVersionLegacy while clients migrate.
+func (b *AxBinProcessor) WithPacketVersion(version uint32) *AxBinProcessor {
+	b.version = version
+	return b
+}
+
+// WithMinPacketVersion rejects incoming packets below version. With a version
+// above PacketVersionLegacy and AES configured, unencrypted packets are
+// rejected as well, so the header can't be downgraded.
+func (b *AxBinProcessor) WithMinPacketVersion(version uint32) *AxBinProcessor {
+	b.minVersion = version
+	return b
+}
+
+// Capabilities advertises the preferred compression first, then every
+// registered codec. With an active AES key only AES is offered. Versions
+// below both WithPacketVersion and WithMinPacketVersion are refused.
+func (b *AxBinProcessor) Capabilities() Capabilities {
+	res := Capabilities{
+		Version:         PacketVersionAuthenticated,
+		MinVersion:      max(b.minVersion, b.version),
+		CompressionSize: b.compressionSize,
+		Encryptions:     []protobuf.PEncryption{protobuf.PEncryption_P_ENCRYPTION_NONE},
+	}
+	if b.compression != protobuf.PCompression_P_COMPRESSION_NONE {
+		res.Compressions = append(res.Compressions, b.compression)
+	}
+	for _, c := range registeredCompressions() {
+		if c != b.compression {
+			res.Compressions = append(res.Compressions, c)
+		}
+	}
+	if b.keyring != nil {
+		if _, _, ok := b.keyring.activeKey(); ok {
+			res.Encryptions = []protobuf.PEncryption{protobuf.PEncryption_P_ENCRYPTION_AES}
+		}
+	}
+	return res
+}
+
+// WithNegotiated returns a copy of the processor that uses n. Incoming
+// packets below the negotiated version, or unencrypted ones once AES is
+// agreed, are rejected.
+func (b *AxBinProcessor) WithNegotiated(n Negotiated) BinProcessor {
+	res := *b
+	res.version = n.Version
+	res.minVersion = max(res.minVersion, n.Version)
+	res.requireAES = n.Encryption == protobuf.PEncryption_P_ENCRYPTION_AES
+	res.compression = n.Compression
+	res.compressionSize = n.CompressionSize
+	return &res
+}
+
 func (b *AxBinProcessor) Unmarshal(in []byte) ([]byte, error) {
+	pck, err := b.UnmarshalPacket(in)
+	if err != nil {
+		return nil, err
+	}
+	return pck.Payload, nil
+}
+
+func (b *AxBinProcessor) Marshal(in []byte) ([]byte, error) {
+	return b.MarshalPacket(&protobuf.PPacket{Payload: in})
+}
+
+func (b *AxBinProcessor) UnmarshalPacket(in []byte) (*protobuf.PPacket, error) {
+	if b.aesErr != nil {
+		return nil, b.aesErr
+	}
 	var pck protobuf.PPacket
 	err := proto.Unmarshal(in, &pck)
 	if err != nil {
 		return nil, err
 	}
+	if pck.Version < b.minVersion {
+		return nil, fmt.Errorf("%w: %d", ErrPacketVersion, pck.Version)
+	}
 	switch pck.Encryption {
 	case protobuf.PEncryption_P_ENCRYPTION_AES:
-		if b.aes == nil {
+		if b.keyring == nil {
 			return nil, ErrNoAES
 		}
-		pck.Payload, err = b.aes.Decrypt(pck.Payload)
+		aes, err := b.keyring.key(pck.KeyId)
 		if err != nil {
 			return nil, err
 		}
+		ad, err := packetAdditionalData(&pck)
+		if err != nil {
+			return nil, err
+		}
+		pck.Payload, err = aes.DecryptWithData(pck.Payload, ad)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if b.requireAES || b.minVersion > PacketVersionLegacy && b.keyring != nil {
+			return nil, ErrNotEncrypted
+		}
+	}
+	if b.replay != nil {
+		if err = b.replay.check(pck.Timestamp, pck.Nonce); err != nil {
+			return nil, err
+		}
 	}
-	switch pck.Compression {
-	case protobuf.PCompression_P_COMPRESSION_GZIP:
-		pck.Payload, err = internal.GUnzipData(pck.Payload)
+	if pck.Compression != protobuf.PCompression_P_COMPRESSION_NONE {
+		codec, err := LookupCodec(pck.Compression)
+		if err != nil {
+			return nil, err
+		}
+		pck.Payload, err = codec.Decompress(pck.Payload)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return pck.Payload, nil
+	return &pck, nil
 }
 
-func (b *AxBinProcessor) Marshal(in []byte) ([]byte, error) {
-	var pck protobuf.PPacket
+func (b *AxBinProcessor) MarshalPacket(pck *protobuf.PPacket) ([]byte, error) {
+	if b.aesErr != nil {
+		return nil, b.aesErr
+	}
 	var err error
-	pck.Payload = in
-	if b.compressionSize > 0 && len(in) > b.compressionSize {
-		pck.Compression = protobuf.PCompression_P_COMPRESSION_GZIP
-		pck.Payload, err = internal.GZipData(pck.Payload)
-		if err != nil {
+	if pck.Version < b.version {
+		pck.Version = b.version
+	}
+	if b.replay != nil {
+		pck.Timestamp = time.Now().UnixMilli()
+		if pck.Nonce, err = newReplayNonce(); err != nil {
 			return nil, err
 		}
 	}
-	if b.aes != nil {
-		pck.Encryption = protobuf.PEncryption_P_ENCRYPTION_AES
-		pck.Payload, err = b.aes.Encrypt(pck.Payload)
+	if b.compressionSize > 0 && len(pck.Payload) > b.compressionSize && b.compression != protobuf.PCompression_P_COMPRESSION_NONE {
+		codec, err := LookupCodec(b.compression)
 		if err != nil {
 			return nil, err
 		}
+		pck.Compression = b.compression
+		pck.Payload, err = codec.Compress(pck.Payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b.keyring != nil {
+		if keyId, aes, ok := b.keyring.activeKey(); ok {
+			pck.Encryption = protobuf.PEncryption_P_ENCRYPTION_AES
+			pck.KeyId = keyId
+			ad, err := packetAdditionalData(pck)
+			if err != nil {
+				return nil, err
+			}
+			pck.Payload, err = aes.EncryptWithData(pck.Payload, ad)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return proto.Marshal(pck)
+}
+
+func unmarshalPacket(bin BinProcessor, in []byte) (*protobuf.PPacket, error) {
+	if p, ok := bin.(PacketProcessor); ok {
+		return p.UnmarshalPacket(in)
+	}
+	data, err := bin.Unmarshal(in)
+	if err != nil {
+		return nil, err
+	}
+	return &protobuf.PPacket{Payload: data}, nil
+}
+
+func marshalPacket(bin BinProcessor, pck *protobuf.PPacket) ([]byte, error) {
+	if p, ok := bin.(PacketProcessor); ok {
+		return p.MarshalPacket(pck)
 	}
-	return proto.Marshal(&pck)
+	return bin.Marshal(pck.Payload)
 }
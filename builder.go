@@ -2,9 +2,13 @@ package axtransport
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
+	"net/http"
 	"time"
 )
 
@@ -22,15 +26,37 @@ type Builder struct {
 	httpApiPath           string
 	httpConnectionTimeout time.Duration
 	httpEventTimeout      time.Duration
+	httpEventBufSize      int
+	httpMaxSessions       int
+	httpMaxIPSessions     int
 	tcpServerHost         string
 	tcpServerPort         int
 	tcpWriteBufSize       int
 	tcpConnectionTimeout  time.Duration
+	tcpWriteTimeout       time.Duration
+	tcpBackpressure       BackpressurePolicy
+	tcpBackpressureWait   time.Duration
+	maxMessageSize        int
+	wsPath                string
+	wsCheckOrigin         func(r *http.Request) bool
 	dataHandlerFunc       DataHandlerFunc
+	interceptors          []Interceptor
+	rateLimits            *RateLimits
+	concurrencyLimits     ConcurrencyLimits
+	dispatchMode          DispatchMode
+	orderingKey           OrderingKeyFunc
 	binProcessor          BinProcessor
 	ctx                   context.Context
 	aesSecret             []byte
+	keyring               *Keyring
+	tlsConfig             *tls.Config
+	handshake             *Handshake
+	hello                 bool
 	compressionSize       int
+	compression           protobuf.PCompression
+	replaySkew            time.Duration
+	packetVersion         uint32
+	minPacketVersion      uint32
 	logger                zerolog.Logger
 	chiRouter             chi.Router
 }
@@ -42,13 +68,16 @@ func AxTransport() *Builder {
 		httpApiPath:           "/api",
 		httpConnectionTimeout: 5 * time.Second,
 		httpEventTimeout:      50 * time.Second,
+		httpEventBufSize:      200,
 		tcpServerHost:         "0.0.0.0",
 		tcpServerPort:         0,
 		tcpWriteBufSize:       200,
 		tcpConnectionTimeout:  30 * time.Second,
+		maxMessageSize:        MaxMessageSize,
 		logger:                zerolog.Nop(),
 		ctx:                   context.Background(),
 		compressionSize:       1024,
+		compression:           protobuf.PCompression_P_COMPRESSION_GZIP,
 	}
 }
 
@@ -79,6 +108,37 @@ func (b *Builder) WithCPWriteBufSize(size int) *Builder {
 	return b
 }
 
+func (b *Builder) WithTCPWriteTimeout(timeout time.Duration) *Builder {
+	b.tcpWriteTimeout = timeout
+	return b
+}
+
+// WithTCPBackpressure selects what a TCP connection does when its out queue
+// is more than half full. timeout bounds the wait of BackpressureBlock, zero
+// waits until the write context is done.
+func (b *Builder) WithTCPBackpressure(policy BackpressurePolicy, timeout time.Duration) *Builder {
+	b.tcpBackpressure = policy
+	b.tcpBackpressureWait = timeout
+	return b
+}
+
+func (b *Builder) WithWebSocket(path string) *Builder {
+	b.wsPath = path
+	return b
+}
+
+func (b *Builder) WithWebSocketCheckOrigin(checkOrigin func(r *http.Request) bool) *Builder {
+	b.wsCheckOrigin = checkOrigin
+	return b
+}
+
+// WithMaxMessageSize limits the size of a message reassembled from chunks on
+// TCP and of a WebSocket message. A size of 0 means no limit.
+func (b *Builder) WithMaxMessageSize(size int) *Builder {
+	b.maxMessageSize = size
+	return b
+}
+
 func (b *Builder) WithHTTPApiPath(path string) *Builder {
 	b.httpApiPath = path
 	return b
@@ -89,11 +149,49 @@ func (b *Builder) WithHTTPEventTimeout(timeout time.Duration) *Builder {
 	return b
 }
 
+func (b *Builder) WithHTTPEventBufSize(size int) *Builder {
+	b.httpEventBufSize = size
+	return b
+}
+
+// WithHTTPMaxSessions limits the long-poll event sessions of the HTTP
+// server, in total and per remote IP.
+func (b *Builder) WithHTTPMaxSessions(size, perIP int) *Builder {
+	b.httpMaxSessions = size
+	b.httpMaxIPSessions = perIP
+	return b
+}
+
 func (b *Builder) WithCompressionSize(size int) *Builder {
 	b.compressionSize = size
 	return b
 }
 
+// WithCompression selects the codec used by the default bin processor for
+// payloads above the compression size. The codec must be registered with
+// RegisterCodec.
+func (b *Builder) WithCompression(compression protobuf.PCompression) *Builder {
+	b.compression = compression
+	return b
+}
+
+// WithReplayProtection makes the default bin processor reject packets older
+// than skew and packets it has already seen.
+func (b *Builder) WithReplayProtection(skew time.Duration) *Builder {
+	b.replaySkew = skew
+	return b
+}
+
+// WithPacketVersion sets the version of packets pushed by the default bin
+// processor and the lowest version it accepts. Replies always use the
+// version of the request. Keep both at PacketVersionLegacy while clients
+// migrate, then raise them to PacketVersionAuthenticated.
+func (b *Builder) WithPacketVersion(version, min uint32) *Builder {
+	b.packetVersion = version
+	b.minPacketVersion = min
+	return b
+}
+
 func (b *Builder) WithHTTPRouter(r chi.Router) *Builder {
 	b.chiRouter = r
 	return b
@@ -114,11 +212,84 @@ func (b *Builder) WithAES(secretKey []byte) *Builder {
 	return b
 }
 
+// WithKeyring sets the AES keys of the default bin processor. The keyring
+// can be changed at runtime to rotate keys without restarting clients.
+// A secret passed to WithAES is added to the keyring as key 0 and only
+// becomes active when the keyring has no active key.
+func (b *Builder) WithKeyring(keyring *Keyring) *Builder {
+	b.keyring = keyring
+	return b
+}
+
+func (b *Builder) WithTLS(config *tls.Config) *Builder {
+	b.tlsConfig = config
+	return b
+}
+
+// WithClientCAs requires clients to present a certificate signed by one of
+// the given CAs. It must be called after WithTLS.
+func (b *Builder) WithClientCAs(pool *x509.CertPool) *Builder {
+	if b.tlsConfig == nil {
+		b.tlsConfig = &tls.Config{}
+	} else {
+		b.tlsConfig = b.tlsConfig.Clone()
+	}
+	b.tlsConfig.ClientCAs = pool
+	b.tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return b
+}
+
+// WithHello makes TCP clients start with a hello frame to agree on packet
+// version, compression and encryption. HTTP servers always answer the hello
+// header. Only WithHandshake authenticates the hello, without it a version
+// below WithPacketVersion is still refused.
+func (b *Builder) WithHello() *Builder {
+	b.hello = true
+	return b
+}
+
+// WithHandshake enables the session key handshake on TCP connections. A
+// handshake without a secret uses the AES secret, so clients must still know
+// it when a private key is set too.
+func (b *Builder) WithHandshake(handshake *Handshake) *Builder {
+	b.handshake = handshake
+	return b
+}
+
 func (b *Builder) WithDataHandlerFunc(dataHandlerFunc DataHandlerFunc) *Builder {
 	b.dataHandlerFunc = dataHandlerFunc
 	return b
 }
 
+// WithRateLimit limits requests of TCP, HTTP and WebSocket. The per IP and
+// global buckets are shared by all transports.
+func (b *Builder) WithRateLimit(limits RateLimits) *Builder {
+	b.rateLimits = &limits
+	return b
+}
+
+// WithConcurrencyLimits bounds TCP and WebSocket connections and handler
+// calls.
+func (b *Builder) WithConcurrencyLimits(limits ConcurrencyLimits) *Builder {
+	b.concurrencyLimits = limits
+	return b
+}
+
+// WithDispatchMode sets the order of TCP handler calls of one connection.
+// key is required by DispatchKeyed.
+func (b *Builder) WithDispatchMode(mode DispatchMode, key OrderingKeyFunc) *Builder {
+	b.dispatchMode = mode
+	b.orderingKey = key
+	return b
+}
+
+// Use adds interceptors around the data handler of every transport. They
+// run in the order they were added, the first one is the outermost.
+func (b *Builder) Use(interceptors ...Interceptor) *Builder {
+	b.interceptors = append(b.interceptors, interceptors...)
+	return b
+}
+
 func (b *Builder) WithCustomBinProcessor(processor BinProcessor) *Builder {
 	b.binProcessor = processor
 	return b
@@ -129,10 +300,22 @@ func (b *Builder) Build() *Transport {
 		b: b,
 	}
 	if b.binProcessor == nil {
-		b.binProcessor = NewAxBinProcessor(b.logger)
+		bin := NewAxBinProcessor(b.logger).
+			WithCompression(b.compression).
+			WithKeyring(b.keyring).
+			WithPacketVersion(b.packetVersion).
+			WithMinPacketVersion(b.minPacketVersion)
+		if b.replaySkew > 0 {
+			bin.WithReplayProtection(b.replaySkew)
+		}
+		b.binProcessor = bin
+	}
+	var rateLimiter *RateLimiter
+	if b.rateLimits != nil {
+		rateLimiter = NewRateLimiter(*b.rateLimits)
 	}
 	if b.httpServerPort != 0 {
-		res.http = NewAxHttp(b.ctx, b.logger, fmt.Sprintf("%s:%d", b.httpServerHost, b.httpServerPort), "/api", b.binProcessor, b.dataHandlerFunc)
+		res.http = NewAxHttp(b.ctx, b.logger, fmt.Sprintf("%s:%d", b.httpServerHost, b.httpServerPort), b.httpApiPath, b.binProcessor, b.dataHandlerFunc)
 		if b.chiRouter != nil {
 			res.http.WithRouter(b.chiRouter)
 		}
@@ -140,6 +323,33 @@ func (b *Builder) Build() *Transport {
 		if b.httpConnectionTimeout != 0 {
 			res.http.WithTimeout(b.httpConnectionTimeout)
 		}
+		if b.httpEventTimeout != 0 {
+			res.http.WithEventTimeout(b.httpEventTimeout)
+		}
+		res.http.WithEventBufSize(b.httpEventBufSize)
+		if b.httpMaxSessions != 0 || b.httpMaxIPSessions != 0 {
+			res.http.WithMaxSessions(b.httpMaxSessions, b.httpMaxIPSessions)
+		}
+		res.http.WithInterceptors(b.interceptors...)
+		res.http.WithRateLimiter(rateLimiter)
+		if b.tlsConfig != nil {
+			res.http.WithTLS(b.tlsConfig)
+		}
+		if b.wsPath != "" {
+			res.ws = NewAxWebSocket(b.ctx, b.logger, b.wsPath, b.tcpWriteBufSize, b.binProcessor, b.dataHandlerFunc)
+			if b.tcpConnectionTimeout != 0 {
+				res.ws.WithTimeout(b.tcpConnectionTimeout)
+			}
+			res.ws.WithMaxMessageSize(b.maxMessageSize)
+			res.ws.WithInterceptors(b.interceptors...)
+			res.ws.WithRateLimiter(rateLimiter)
+			res.ws.WithConcurrencyLimits(b.concurrencyLimits)
+			if b.wsCheckOrigin != nil {
+				res.ws.WithCheckOrigin(b.wsCheckOrigin)
+			}
+			res.ws.Mount(res.http.parentRouter)
+			b.logger.Debug().Str("ws-path", b.wsPath).Msg("websocket server created")
+		}
 		if b.aesSecret != nil {
 			res.http.WithAES(b.aesSecret)
 		}
@@ -153,6 +363,26 @@ func (b *Builder) Build() *Transport {
 		if b.aesSecret != nil {
 			res.tcp.WithAES(b.aesSecret)
 		}
+		res.tcp.WithMaxMessageSize(b.maxMessageSize)
+		res.tcp.WithInterceptors(b.interceptors...)
+		res.tcp.WithRateLimiter(rateLimiter)
+		res.tcp.WithConcurrencyLimits(b.concurrencyLimits)
+		res.tcp.WithDispatchMode(b.dispatchMode, b.orderingKey)
+		if b.tcpWriteTimeout != 0 {
+			res.tcp.WithWriteTimeout(b.tcpWriteTimeout)
+		}
+		res.tcp.WithBackpressure(b.tcpBackpressure, b.tcpBackpressureWait)
+		if b.tlsConfig != nil {
+			res.tcp.WithTLS(b.tlsConfig)
+		}
+		if b.handshake != nil {
+			handshake := *b.handshake
+			if handshake.Secret == nil {
+				handshake.Secret = b.aesSecret
+			}
+			res.tcp.WithHandshake(&handshake)
+		}
+		res.tcp.WithHello(b.hello)
 		res.tcp.WithCompressionSize(b.compressionSize)
 	}
 	return res
@@ -1,8 +1,14 @@
 package axtransport
 
 import (
+	"context"
 	"github.com/axgrid/axtransport/internal"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
 	"testing"
+	"time"
 )
 
 type customBin struct {
@@ -44,3 +50,41 @@ func TestBuilder_Build(t *testing.T) {
 		panic("not customBin in tcp")
 	}
 }
+
+func TestHttpClientBuilder_Build(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8089).
+		WithCustomBinProcessor(&customBin{}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client := NewAxHttpClientBuilder().WithBinProcessor(&customBin{}).Build()
+	data, err := client.Post("http://localhost:8089/api", []byte("custom"))
+	require.Nil(t, err)
+	assert.Equal(t, "custom", string(data))
+
+	key := []byte("12345678901234567890123456789012")
+	client = NewAxHttpClientBuilder().WithAES(key).WithCompressionSize(10).Build()
+	bin, ok := client.binProcessor.(*AxBinProcessor)
+	require.True(t, ok)
+	assert.Equal(t, 10, bin.compressionSize)
+	assert.Equal(t, 1024, NewAxHttpClient(nil).binProcessor.(*AxBinProcessor).compressionSize)
+
+	custom := NewAxBinProcessor(zerolog.Nop())
+	custom.WithCompressionSize(10)
+	client = NewAxHttpClientBuilder().WithBinProcessor(custom).Build()
+	assert.Equal(t, 10, custom.compressionSize)
+
+	httpClient := &http.Client{Timeout: time.Minute}
+	client = NewAxHttpClientBuilder().WithHTTPClient(httpClient).Build()
+	assert.Equal(t, time.Minute, client.client.Timeout)
+	assert.Equal(t, time.Duration(0), client.timeout)
+	client = NewAxHttpClientBuilder().WithHTTPClient(httpClient).WithTimeout(time.Second).Build()
+	assert.Equal(t, time.Second, client.timeout)
+	assert.Equal(t, time.Minute, httpClient.Timeout)
+}
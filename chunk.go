@@ -0,0 +1,130 @@
+package axtransport
+
+import (
+	"errors"
+	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
+	"sync/atomic"
+)
+
+// MaxMessageSize is the default limit of a message reassembled from chunks.
+var MaxMessageSize = 16 * 1024 * 1024
+
+const (
+	// chunkOverhead leaves room for the PControl envelope around chunk data.
+	chunkOverhead = 64
+	// minChunkSize bounds the chunk count accepted for a message, every chunk
+	// but the last one of a message must be at least this size.
+	minChunkSize = 1024
+	// maxChunkMessages limits the incomplete messages of one connection.
+	maxChunkMessages = 16
+	// chunkPartSize is charged to the budget for every stored chunk.
+	chunkPartSize = 24
+)
+
+var (
+	ErrMessageTooBig = errors.New("message too big")
+	ErrInvalidChunk  = errors.New("invalid chunk")
+)
+
+var chunkMessageSeq atomic.Uint64
+
+// dataFrames frames a marshaled packet. Packets larger than MaxBodySize are
+// split into chunk control frames.
+func dataFrames(body []byte) ([][]byte, error) {
+	if uint32(len(body)) <= MaxBodySize {
+		return [][]byte{addSize32(body)}, nil
+	}
+	chunkSize := int(MaxBodySize) - chunkOverhead
+	count := (len(body) + chunkSize - 1) / chunkSize
+	messageId := chunkMessageSeq.Add(1)
+	res := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(body) {
+			end = len(body)
+		}
+		frame, err := marshalControl(&protobuf.PControl{
+			Type: protobuf.PControlType_P_CONTROL_CHUNK,
+			Chunk: &protobuf.PChunk{
+				MessageId: messageId,
+				Index:     uint32(i),
+				Count:     uint32(count),
+				Data:      body[i*chunkSize : end],
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, frame)
+	}
+	return res, nil
+}
+
+// chunkAssembler collects the chunks of one connection. The bytes buffered
+// for all incomplete messages together, including a part slot for every
+// chunk, are limited by maxSize, and at most maxChunkMessages may be
+// incomplete at once. A maxSize of 0 means no limit.
+type chunkAssembler struct {
+	maxSize  int
+	size     int
+	messages map[uint64]*chunkMessage
+}
+
+type chunkMessage struct {
+	count uint32
+	parts map[uint32][]byte
+	size  int
+}
+
+func newChunkAssembler(maxSize int) *chunkAssembler {
+	return &chunkAssembler{
+		maxSize:  maxSize,
+		messages: make(map[uint64]*chunkMessage),
+	}
+}
+
+// add stores a chunk and returns the reassembled packet once every chunk of
+// its message has arrived.
+func (c *chunkAssembler) add(chunk *protobuf.PChunk) ([]byte, error) {
+	if chunk == nil || chunk.Count == 0 || chunk.Index >= chunk.Count {
+		return nil, ErrInvalidChunk
+	}
+	if c.maxSize > 0 && int(chunk.Count) > c.maxSize/minChunkSize+1 {
+		return nil, fmt.Errorf("%w: %d chunks", ErrMessageTooBig, chunk.Count)
+	}
+	if chunk.Index < chunk.Count-1 && len(chunk.Data) < minChunkSize {
+		return nil, fmt.Errorf("%w: chunk of %d bytes", ErrInvalidChunk, len(chunk.Data))
+	}
+	msg, ok := c.messages[chunk.MessageId]
+	if !ok {
+		if len(c.messages) >= maxChunkMessages {
+			return nil, fmt.Errorf("%w: %d incomplete messages", ErrMessageTooBig, len(c.messages))
+		}
+		msg = &chunkMessage{count: chunk.Count, parts: make(map[uint32][]byte)}
+		c.messages[chunk.MessageId] = msg
+	}
+	if msg.count != chunk.Count {
+		return nil, ErrInvalidChunk
+	}
+	if _, ok := msg.parts[chunk.Index]; ok {
+		return nil, ErrInvalidChunk
+	}
+	size := len(chunk.Data) + chunkPartSize
+	c.size += size
+	if c.maxSize > 0 && c.size > c.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooBig, c.size)
+	}
+	msg.parts[chunk.Index] = chunk.Data
+	msg.size += size
+	if len(msg.parts) < int(msg.count) {
+		return nil, nil
+	}
+	delete(c.messages, chunk.MessageId)
+	c.size -= msg.size
+	res := make([]byte, 0, msg.size-len(msg.parts)*chunkPartSize)
+	for i := uint32(0); i < msg.count; i++ {
+		res = append(res, msg.parts[i]...)
+	}
+	return res, nil
+}
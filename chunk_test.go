@@ -0,0 +1,92 @@
+package axtransport
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAxTcp_ChunkedMessages(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8096).WithAES(key).WithMaxMessageSize(4 * 1024 * 1024).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8096", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	payload := make([]byte, 3*1024*1024)
+	_, _ = rand.Read(payload)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data, err := client.Request(ctx, payload)
+	require.Nil(t, err)
+	assert.Equal(t, payload, data)
+
+	tooBig := make([]byte, 5*1024*1024)
+	_, _ = rand.Read(tooBig)
+	_, err = client.Request(ctx, tooBig)
+	assert.NotNil(t, err)
+	assert.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, 10*time.Millisecond)
+}
+
+func TestChunkAssembler_Limits(t *testing.T) {
+	c := newChunkAssembler(2048)
+	_, err := c.add(&protobuf.PChunk{MessageId: 1, Index: 2, Count: 2})
+	assert.ErrorIs(t, err, ErrInvalidChunk)
+	_, err = c.add(&protobuf.PChunk{MessageId: 1, Index: 0, Count: 2, Data: []byte("hello")})
+	assert.ErrorIs(t, err, ErrInvalidChunk)
+
+	head := make([]byte, minChunkSize)
+	res, err := c.add(&protobuf.PChunk{MessageId: 1, Index: 1, Count: 2, Data: []byte("world")})
+	require.Nil(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, chunkPartSize+5, c.size)
+	_, err = c.add(&protobuf.PChunk{MessageId: 1, Index: 1, Count: 2, Data: []byte("world")})
+	assert.ErrorIs(t, err, ErrInvalidChunk)
+	res, err = c.add(&protobuf.PChunk{MessageId: 1, Index: 0, Count: 2, Data: head})
+	require.Nil(t, err)
+	assert.Equal(t, append(head, "world"...), res)
+	assert.Equal(t, 0, c.size)
+
+	_, err = c.add(&protobuf.PChunk{MessageId: 2, Index: 0, Count: 2, Data: make([]byte, 1500)})
+	require.Nil(t, err)
+	_, err = c.add(&protobuf.PChunk{MessageId: 2, Index: 1, Count: 2, Data: make([]byte, 1500)})
+	assert.ErrorIs(t, err, ErrMessageTooBig)
+	_, err = c.add(&protobuf.PChunk{MessageId: 3, Index: 0, Count: 1000})
+	assert.ErrorIs(t, err, ErrMessageTooBig)
+}
+
+func TestChunkAssembler_MessageLimit(t *testing.T) {
+	c := newChunkAssembler(MaxMessageSize)
+	for i := 0; i < maxChunkMessages; i++ {
+		_, err := c.add(&protobuf.PChunk{MessageId: uint64(i), Index: 1, Count: 2})
+		require.Nil(t, err)
+	}
+	_, err := c.add(&protobuf.PChunk{MessageId: maxChunkMessages, Index: 1, Count: 2})
+	assert.ErrorIs(t, err, ErrMessageTooBig)
+}
+
+func TestChunkAssembler_NoLimit(t *testing.T) {
+	c := newChunkAssembler(0)
+	head := make([]byte, 4*minChunkSize)
+	_, err := c.add(&protobuf.PChunk{MessageId: 1, Index: 0, Count: 100000, Data: head})
+	require.Nil(t, err)
+	_, err = c.add(&protobuf.PChunk{MessageId: 2, Index: 0, Count: 2, Data: head})
+	require.Nil(t, err)
+	res, err := c.add(&protobuf.PChunk{MessageId: 2, Index: 1, Count: 2, Data: []byte("tail")})
+	require.Nil(t, err)
+	assert.Equal(t, append(head, "tail"...), res)
+	assert.Equal(t, chunkPartSize+len(head), c.size)
+}
@@ -0,0 +1,73 @@
+package axtransport
+
+import (
+	"fmt"
+	"github.com/axgrid/axtransport/internal"
+	"github.com/axgrid/axtransport/protobuf"
+	"sort"
+	"sync"
+)
+
+type Codec interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+type UnknownCodecError struct {
+	Compression protobuf.PCompression
+}
+
+func (e *UnknownCodecError) Error() string {
+	return fmt.Sprintf("unknown compression codec %s", e.Compression)
+}
+
+type funcCodec struct {
+	compress   func(data []byte) ([]byte, error)
+	decompress func(data []byte) ([]byte, error)
+}
+
+func (c funcCodec) Compress(data []byte) ([]byte, error) {
+	return c.compress(data)
+}
+
+func (c funcCodec) Decompress(data []byte) ([]byte, error) {
+	return c.decompress(data)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[protobuf.PCompression]Codec{
+		protobuf.PCompression_P_COMPRESSION_GZIP:    funcCodec{internal.GZipData, internal.GUnzipData},
+		protobuf.PCompression_P_COMPRESSION_DEFLATE: funcCodec{internal.DeflateData, internal.InflateData},
+		protobuf.PCompression_P_COMPRESSION_ZLIB:    funcCodec{internal.ZlibData, internal.UnzlibData},
+	}
+)
+
+// RegisterCodec makes a codec available to every AxBinProcessor. Registering
+// a codec for an existing compression value replaces it.
+func RegisterCodec(compression protobuf.PCompression, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[compression] = codec
+}
+
+func registeredCompressions() []protobuf.PCompression {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	res := make([]protobuf.PCompression, 0, len(codecs))
+	for c := range codecs {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+func LookupCodec(compression protobuf.PCompression) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[compression]
+	if !ok {
+		return nil, &UnknownCodecError{Compression: compression}
+	}
+	return codec, nil
+}
@@ -0,0 +1,60 @@
+package axtransport
+
+import (
+	"bytes"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/golang/protobuf/proto"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type xorCodec struct{}
+
+func (xorCodec) Compress(data []byte) ([]byte, error) {
+	res := make([]byte, len(data))
+	for i, b := range data {
+		res[i] = b ^ 0x5a
+	}
+	return res, nil
+}
+
+func (c xorCodec) Decompress(data []byte) ([]byte, error) {
+	return c.Compress(data)
+}
+
+func TestAxBinProcessor_Codecs(t *testing.T) {
+	custom := protobuf.PCompression(100)
+	RegisterCodec(custom, xorCodec{})
+	payload := bytes.Repeat([]byte("compress me "), 200)
+	for _, c := range []protobuf.PCompression{
+		protobuf.PCompression_P_COMPRESSION_GZIP,
+		protobuf.PCompression_P_COMPRESSION_DEFLATE,
+		protobuf.PCompression_P_COMPRESSION_ZLIB,
+		custom,
+	} {
+		bin := NewAxBinProcessor(zerolog.Nop()).WithCompression(c)
+		bin.WithCompressionSize(100)
+		data, err := bin.Marshal(payload)
+		require.Nil(t, err, c.String())
+		var pck protobuf.PPacket
+		require.Nil(t, proto.Unmarshal(data, &pck))
+		assert.Equal(t, c, pck.Compression)
+		data, err = NewAxBinProcessor(zerolog.Nop()).Unmarshal(data)
+		require.Nil(t, err, c.String())
+		assert.Equal(t, payload, data)
+	}
+}
+
+func TestAxBinProcessor_UnknownCodec(t *testing.T) {
+	data, err := proto.Marshal(&protobuf.PPacket{
+		Payload:     []byte("snappy data"),
+		Compression: protobuf.PCompression_P_COMPRESSION_SNAPPY,
+	})
+	require.Nil(t, err)
+	_, err = NewAxBinProcessor(zerolog.Nop()).Unmarshal(data)
+	var codecErr *UnknownCodecError
+	require.ErrorAs(t, err, &codecErr)
+	assert.Equal(t, protobuf.PCompression_P_COMPRESSION_SNAPPY, codecErr.Compression)
+}
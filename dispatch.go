@@ -0,0 +1,98 @@
+package axtransport
+
+import "sync"
+
+// DispatchMode decides how the messages of one connection are handed to the
+// handler.
+type DispatchMode int
+
+const (
+	// DispatchConcurrent runs every message in its own goroutine.
+	DispatchConcurrent DispatchMode = iota
+	// DispatchSequential runs the messages of a connection one by one in the
+	// order they were received.
+	DispatchSequential
+	// DispatchKeyed runs messages with the same OrderingKeyFunc result one
+	// by one, messages with different keys run concurrently.
+	DispatchKeyed
+)
+
+func (m DispatchMode) String() string {
+	switch m {
+	case DispatchConcurrent:
+		return "concurrent"
+	case DispatchSequential:
+		return "sequential"
+	case DispatchKeyed:
+		return "keyed"
+	default:
+		return "unknown"
+	}
+}
+
+// OrderingKeyFunc returns the ordering key of a decoded payload.
+type OrderingKeyFunc func(data []byte) string
+
+// dispatcher serves one connection.
+type dispatcher struct {
+	mode    DispatchMode
+	key     OrderingKeyFunc
+	mu      sync.Mutex
+	queues  map[string][]func()
+	stopped bool
+}
+
+func newDispatcher(mode DispatchMode, key OrderingKeyFunc) *dispatcher {
+	if mode == DispatchKeyed && key == nil {
+		mode = DispatchSequential
+	}
+	return &dispatcher{mode: mode, key: key, queues: make(map[string][]func())}
+}
+
+func (d *dispatcher) dispatch(data []byte, task func()) {
+	var key string
+	switch d.mode {
+	case DispatchConcurrent:
+		go task()
+		return
+	case DispatchKeyed:
+		key = d.key(data)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	queue, running := d.queues[key]
+	d.queues[key] = append(queue, task)
+	if !running {
+		go d.run(key)
+	}
+}
+
+// run drains the queue of key and removes it once empty.
+func (d *dispatcher) run(key string) {
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		task := queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+		task()
+	}
+}
+
+// stop drops the queued tasks, the running ones finish.
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	for key := range d.queues {
+		d.queues[key] = nil
+	}
+}
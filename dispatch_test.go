@@ -0,0 +1,159 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher_Keyed(t *testing.T) {
+	d := newDispatcher(DispatchKeyed, func(data []byte) string {
+		return strings.Split(string(data), ":")[0]
+	})
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	got := map[string][]string{}
+	messages := []string{"a:60ms", "b:0s", "a:0s", "b:60ms", "a:1ms"}
+	start := time.Now()
+	for _, m := range messages {
+		m := m
+		wg.Add(1)
+		d.dispatch([]byte(m), func() {
+			defer wg.Done()
+			delay, _ := time.ParseDuration(strings.Split(m, ":")[1])
+			time.Sleep(delay)
+			mu.Lock()
+			defer mu.Unlock()
+			key := strings.Split(m, ":")[0]
+			got[key] = append(got[key], m)
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"a:60ms", "a:0s", "a:1ms"}, got["a"])
+	assert.Equal(t, []string{"b:0s", "b:60ms"}, got["b"])
+	// keys run concurrently
+	assert.Less(t, time.Since(start), 110*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(d.queues) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDispatcher_Stop(t *testing.T) {
+	d := newDispatcher(DispatchKeyed, func(data []byte) string { return "" })
+	release := make(chan struct{})
+	var ran sync.WaitGroup
+	ran.Add(1)
+	calls := make(chan string, 3)
+	d.dispatch([]byte("first"), func() {
+		ran.Done()
+		<-release
+		calls <- "first"
+	})
+	d.dispatch([]byte("second"), func() { calls <- "second" })
+	ran.Wait()
+	d.stop()
+	d.dispatch([]byte("third"), func() { calls <- "third" })
+	close(release)
+	assert.Equal(t, "first", <-calls)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, calls, 0)
+}
+
+func TestAxTcpClient_HandlerErrorStopsReading(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8114).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	calls := make(chan string, 10)
+	client, err := NewAxTcpClient("localhost:8114", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		calls <- string(data)
+		return errors.New("handler failed")
+	})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	_, err = client.Request(context.Background(), []byte("ready"))
+	require.Nil(t, err)
+
+	for _, m := range []string{"one", "two", "three"} {
+		require.Nil(t, transport.Broadcast([]byte(m)))
+	}
+	assert.Equal(t, "one", waitString(t, calls))
+	assert.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, 10*time.Millisecond)
+	assert.Len(t, calls, 0)
+}
+
+func TestAxTcp_DispatchSequential(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		delay, _ := time.ParseDuration(string(d))
+		time.Sleep(delay)
+		return d, nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8103).
+		WithDispatchMode(DispatchSequential, nil).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	delays := []string{"100ms", "50ms", "0s", "20ms"}
+	received := make(chan string, len(delays))
+	client, err := NewAxTcpClient("localhost:8103", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		received <- string(data)
+		return nil
+	})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	for _, d := range delays {
+		require.Nil(t, client.Send([]byte(d)))
+	}
+	for _, d := range delays {
+		assert.Equal(t, d, waitString(t, received))
+	}
+}
+
+func TestAxTcpClient_RequestFromSequentialHandler(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8122).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	errs := make(chan error, 1)
+	client, err := NewAxTcpClient("localhost:8122", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		_, err := client.Request(ctx, []byte("nested"))
+		errs <- err
+		return nil
+	})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	_, err = client.Request(context.Background(), []byte("ready"))
+	require.Nil(t, err)
+	require.Nil(t, transport.Broadcast([]byte("push")))
+	select {
+	case err = <-errs:
+		assert.ErrorIs(t, err, ErrRequestInHandler)
+	case <-time.After(2 * time.Second):
+		t.Fatal("request from handler blocked")
+	}
+}
@@ -0,0 +1,189 @@
+package axtransport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoEndpoints = errors.New("no endpoints")
+
+// Resolver returns the addresses an AxTcpClient can connect to.
+type Resolver interface {
+	Endpoints() ([]string, error)
+}
+
+type StaticResolver []string
+
+func (r StaticResolver) Endpoints() ([]string, error) {
+	return r, nil
+}
+
+// FileResolver reads endpoints from a file, one address per line, lines
+// starting with # are ignored. The file is reloaded when it changes.
+type FileResolver struct {
+	path      string
+	logger    zerolog.Logger
+	mu        sync.RWMutex
+	endpoints []string
+	modTime   time.Time
+	size      int64
+}
+
+// NewFileResolver loads path and checks it for changes every interval until
+// ctx is done.
+func NewFileResolver(ctx context.Context, logger zerolog.Logger, path string, interval time.Duration) (*FileResolver, error) {
+	res := &FileResolver{path: path, logger: logger}
+	if err := res.reload(); err != nil {
+		return nil, err
+	}
+	go res.watch(ctx, interval)
+	return res, nil
+}
+
+func (r *FileResolver) Endpoints() ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.endpoints, nil
+}
+
+func (r *FileResolver) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				r.logger.Warn().Err(err).Str("path", r.path).Msg("reload endpoints failed")
+			}
+		}
+	}
+}
+
+func (r *FileResolver) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	changed := !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+	r.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var endpoints []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		endpoints = append(endpoints, line)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints, r.modTime, r.size = endpoints, info.ModTime(), info.Size()
+	return nil
+}
+
+// EndpointPolicy decides which endpoint is tried first.
+type EndpointPolicy int
+
+const (
+	EndpointRoundRobin EndpointPolicy = iota
+	EndpointRandom
+	// EndpointLeastLatency prefers the endpoint with the lowest connect or
+	// heartbeat round trip time.
+	EndpointLeastLatency
+)
+
+// endpointPool orders endpoints for a connect attempt. Endpoints that
+// failed stay behind healthy ones until their cooldown ends.
+type endpointPool struct {
+	resolver Resolver
+	policy   EndpointPolicy
+	cooldown time.Duration
+	mu       sync.Mutex
+	next     int
+	down     map[string]time.Time
+	latency  map[string]time.Duration
+}
+
+func newEndpointPool(resolver Resolver, policy EndpointPolicy, cooldown time.Duration) *endpointPool {
+	return &endpointPool{
+		resolver: resolver,
+		policy:   policy,
+		cooldown: cooldown,
+		down:     make(map[string]time.Time),
+		latency:  make(map[string]time.Duration),
+	}
+}
+
+func (p *endpointPool) candidates() ([]string, error) {
+	endpoints, err := p.resolver.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ordered := make([]string, len(endpoints))
+	switch p.policy {
+	case EndpointRandom:
+		for i, j := range rand.Perm(len(endpoints)) {
+			ordered[i] = endpoints[j]
+		}
+	case EndpointLeastLatency:
+		copy(ordered, endpoints)
+		// endpoints without a measurement go first to get one
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return p.latency[ordered[i]] < p.latency[ordered[j]]
+		})
+	default:
+		start := p.next % len(endpoints)
+		p.next++
+		for i := range endpoints {
+			ordered[i] = endpoints[(start+i)%len(endpoints)]
+		}
+	}
+	now := time.Now()
+	healthy := make([]string, 0, len(ordered))
+	var unhealthy []string
+	for _, endpoint := range ordered {
+		if until, ok := p.down[endpoint]; ok && now.Before(until) {
+			unhealthy = append(unhealthy, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	return append(healthy, unhealthy...), nil
+}
+
+func (p *endpointPool) markDown(endpoint string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down[endpoint] = time.Now().Add(p.cooldown)
+}
+
+func (p *endpointPool) observe(endpoint string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.down, endpoint)
+	p.latency[endpoint] = latency
+}
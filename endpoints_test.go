@@ -0,0 +1,77 @@
+package axtransport
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointPool(t *testing.T) {
+	pool := newEndpointPool(StaticResolver{"a", "b", "c"}, EndpointRoundRobin, time.Minute)
+	first, err := pool.candidates()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, first)
+	second, _ := pool.candidates()
+	assert.Equal(t, []string{"b", "c", "a"}, second)
+
+	pool.markDown("c")
+	third, _ := pool.candidates()
+	assert.Equal(t, []string{"a", "b", "c"}, third)
+	pool.observe("c", time.Millisecond)
+	fourth, _ := pool.candidates()
+	assert.Equal(t, []string{"a", "b", "c"}, fourth)
+
+	pool = newEndpointPool(StaticResolver{"a", "b", "c"}, EndpointLeastLatency, time.Minute)
+	pool.observe("a", 30*time.Millisecond)
+	pool.observe("b", 10*time.Millisecond)
+	pool.observe("c", 20*time.Millisecond)
+	ordered, _ := pool.candidates()
+	assert.Equal(t, []string{"b", "c", "a"}, ordered)
+
+	_, err = newEndpointPool(StaticResolver{}, EndpointRandom, 0).candidates()
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+}
+
+func TestFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints")
+	require.Nil(t, os.WriteFile(path, []byte("# nodes\nlocalhost:1\n\n localhost:2 \n"), 0o644))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver, err := NewFileResolver(ctx, zerolog.Nop(), path, 10*time.Millisecond)
+	require.Nil(t, err)
+	endpoints, err := resolver.Endpoints()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"localhost:1", "localhost:2"}, endpoints)
+
+	require.Nil(t, os.WriteFile(path, []byte("localhost:3\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		endpoints, _ := resolver.Endpoints()
+		return len(endpoints) == 1 && endpoints[0] == "localhost:3"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestAxTcpClient_Failover(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8108).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	client.SetResolver(StaticResolver{"localhost:8107", "localhost:8108"}, EndpointRoundRobin, time.Minute)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	assert.Equal(t, "localhost:8108", client.Address())
+	data, err := client.Request(context.Background(), []byte("failover"))
+	require.Nil(t, err)
+	assert.Equal(t, "failover", string(data))
+}
@@ -0,0 +1,124 @@
+package axtransport
+
+import (
+	"errors"
+	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"net"
+	"time"
+)
+
+// Control frames carry a PControl message instead of a PPacket. They are
+// marked by the high bit of the length prefix, which data frames never set
+// because their size is limited by MaxBodySize.
+const frameControlFlag = uint32(1) << 31
+
+var (
+	ErrEmptyFrame  = errors.New("empty frame")
+	ErrFrameTooBig = errors.New("frame too big")
+)
+
+// RemoteError is an error reported by the peer in an error control frame.
+type RemoteError struct {
+	Code    protobuf.PErrorCode
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error: %s: %s", e.Code, e.Message)
+}
+
+func (e *RemoteError) Is(target error) bool {
+	switch e.Code {
+	case protobuf.PErrorCode_P_ERROR_RATE_LIMITED:
+		return target == ErrRateLimited
+	case protobuf.PErrorCode_P_ERROR_OVERLOADED:
+		return target == ErrOverloaded
+	case protobuf.PErrorCode_P_ERROR_INCOMPATIBLE:
+		return target == ErrIncompatible
+	default:
+		return false
+	}
+}
+
+type deadlineReader interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+}
+
+// readFrame reads one frame from conn. headerTimeout and bodyTimeout bound
+// the two reads, zero means no deadline.
+func readFrame(conn deadlineReader, headerTimeout, bodyTimeout time.Duration) ([]byte, bool, error) {
+	if err := conn.SetReadDeadline(deadline(headerTimeout)); err != nil {
+		return nil, false, err
+	}
+	sizeBytes, err := readNBytes(conn, 4)
+	if err != nil {
+		return nil, false, err
+	}
+	bodyLength := getUInt32FromBytes(sizeBytes)
+	control := bodyLength&frameControlFlag != 0
+	bodyLength &^= frameControlFlag
+	if bodyLength == 0 {
+		return nil, control, ErrEmptyFrame
+	}
+	if bodyLength > MaxBodySize {
+		return nil, control, fmt.Errorf("%w: %d", ErrFrameTooBig, bodyLength)
+	}
+	if err = conn.SetReadDeadline(deadline(bodyTimeout)); err != nil {
+		return nil, control, err
+	}
+	body, err := readNBytes(conn, int(bodyLength))
+	if err != nil {
+		return nil, control, err
+	}
+	return body, control, nil
+}
+
+func deadline(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func marshalControl(c *protobuf.PControl) ([]byte, error) {
+	body, err := proto.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return append(getBytesFromUInt32(uint32(len(body))|frameControlFlag), body...), nil
+}
+
+func unmarshalControl(body []byte) (*protobuf.PControl, error) {
+	var c protobuf.PControl
+	if err := proto.Unmarshal(body, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func writeControl(conn net.Conn, timeout time.Duration, c *protobuf.PControl) error {
+	data, err := marshalControl(c)
+	if err != nil {
+		return err
+	}
+	if err = conn.SetWriteDeadline(deadline(timeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+func readControl(conn net.Conn, timeout time.Duration) (*protobuf.PControl, error) {
+	body, control, err := readFrame(conn, timeout, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if !control {
+		return nil, errors.New("control frame expected")
+	}
+	return unmarshalControl(body)
+}
@@ -7,9 +7,12 @@ toolchain go1.22.0
 require (
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/golang/protobuf v1.5.4
+	github.com/gorilla/websocket v1.5.3
+	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.20.5
 	github.com/rs/zerolog v1.33.0
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/time v0.8.0
 	google.golang.org/protobuf v1.36.4
 )
 
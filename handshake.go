@@ -0,0 +1,147 @@
+package axtransport
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"github.com/axgrid/axtransport/internal"
+	"github.com/axgrid/axtransport/protobuf"
+	"net"
+	"time"
+)
+
+var (
+	ErrHandshakeFailed        = errors.New("handshake failed")
+	ErrHandshakeNoAuth        = errors.New("handshake needs a secret or a server key")
+	ErrSessionKeyNotSupported = errors.New("bin processor does not support session keys")
+)
+
+// Handshake configures the ephemeral X25519 key exchange run at the start of
+// a TCP connection. The derived key replaces the static AES key for the rest
+// of the connection, so a leaked key does not expose recorded sessions.
+//
+// The exchange is authenticated either by Secret, a key shared by both sides,
+// or by the server identity: PrivateKey on the server, PublicKey on clients.
+// A preceding hello exchange is part of the authenticated transcript.
+// When both are set the server checks the client MAC as well. PrivateKey
+// alone authenticates only the server, any client can obtain a session key.
+type Handshake struct {
+	Secret     []byte
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// SessionBinProcessor is implemented by bin processors that can encrypt with
+// a per-connection key negotiated by the handshake.
+type SessionBinProcessor interface {
+	BinProcessor
+	WithSessionKey(key []byte) BinProcessor
+}
+
+const (
+	handshakeClientLabel = "axtransport client"
+	handshakeServerLabel = "axtransport server"
+	handshakeKeyInfo     = "axtransport session key"
+)
+
+func (h *Handshake) mac(label string, keys ...[]byte) []byte {
+	m := hmac.New(sha256.New, h.Secret)
+	m.Write([]byte(label))
+	for _, k := range keys {
+		m.Write(k)
+	}
+	return m.Sum(nil)
+}
+
+func (h *Handshake) client(conn net.Conn, timeout time.Duration, hello []byte) ([]byte, error) {
+	if h.Secret == nil && h.PublicKey == nil {
+		return nil, ErrHandshakeNoAuth
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	clientPub := priv.PublicKey().Bytes()
+	req := &protobuf.PHandshake{PublicKey: clientPub}
+	if h.Secret != nil {
+		req.Signature = h.mac(handshakeClientLabel, clientPub, hello)
+	}
+	if err = writeControl(conn, timeout, &protobuf.PControl{Type: protobuf.PControlType_P_CONTROL_HANDSHAKE, Handshake: req}); err != nil {
+		return nil, err
+	}
+	c, err := readControl(conn, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if c.Type != protobuf.PControlType_P_CONTROL_HANDSHAKE || c.Handshake == nil {
+		return nil, ErrHandshakeFailed
+	}
+	serverPub := c.Handshake.PublicKey
+	if h.PublicKey != nil {
+		if !ed25519.Verify(h.PublicKey, transcript(clientPub, serverPub, hello), c.Handshake.Signature) {
+			return nil, ErrHandshakeFailed
+		}
+	} else if !hmac.Equal(h.mac(handshakeServerLabel, clientPub, serverPub, hello), c.Handshake.Signature) {
+		return nil, ErrHandshakeFailed
+	}
+	return deriveSessionKey(priv, serverPub, transcript(clientPub, serverPub, hello))
+}
+
+func (h *Handshake) server(conn net.Conn, timeout time.Duration, hello []byte) ([]byte, error) {
+	if h.Secret == nil && h.PrivateKey == nil {
+		return nil, ErrHandshakeNoAuth
+	}
+	c, err := readControl(conn, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if c.Type != protobuf.PControlType_P_CONTROL_HANDSHAKE || c.Handshake == nil {
+		return nil, ErrHandshakeFailed
+	}
+	clientPub := c.Handshake.PublicKey
+	if h.Secret != nil && !hmac.Equal(h.mac(handshakeClientLabel, clientPub, hello), c.Handshake.Signature) {
+		return nil, ErrHandshakeFailed
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serverPub := priv.PublicKey().Bytes()
+	resp := &protobuf.PHandshake{PublicKey: serverPub}
+	if h.PrivateKey != nil {
+		resp.Signature = ed25519.Sign(h.PrivateKey, transcript(clientPub, serverPub, hello))
+	} else {
+		resp.Signature = h.mac(handshakeServerLabel, clientPub, serverPub, hello)
+	}
+	if err = writeControl(conn, timeout, &protobuf.PControl{Type: protobuf.PControlType_P_CONTROL_HANDSHAKE, Handshake: resp}); err != nil {
+		return nil, err
+	}
+	return deriveSessionKey(priv, clientPub, transcript(clientPub, serverPub, hello))
+}
+
+func transcript(clientPub, serverPub, hello []byte) []byte {
+	return append(append(append([]byte{}, clientPub...), serverPub...), hello...)
+}
+
+func deriveSessionKey(priv *ecdh.PrivateKey, peerPub, transcript []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(peerPub)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	return internal.HKDF32(shared, transcript, []byte(handshakeKeyInfo)), nil
+}
+
+func sessionBinProcessor(bin BinProcessor, key []byte) (BinProcessor, error) {
+	s, ok := bin.(SessionBinProcessor)
+	if !ok {
+		return nil, ErrSessionKeyNotSupported
+	}
+	return s.WithSessionKey(key), nil
+}
@@ -0,0 +1,137 @@
+package axtransport
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshake_SharedSecret(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8094).WithAES(key).WithHandshake(&Handshake{}).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	pushes := make(chan string, 1)
+	client, err := NewAxTcpClient("localhost:8094", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		pushes <- string(data)
+		return nil
+	})
+	client.SetHandshake(&Handshake{})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	data, err := client.Request(context.Background(), []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+	require.Nil(t, transport.Broadcast([]byte("push")))
+	assert.Equal(t, "push", waitString(t, pushes))
+
+	wrong, err := NewAxTcpClient("localhost:8094", []byte("abcdefghijklmnopqrstuvwxyz012345"), context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	wrong.SetHandler(nil)
+	wrong.SetHandshake(&Handshake{})
+	assert.NotNil(t, wrong.Connect())
+}
+
+func TestHandshake_ServerKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8095).WithHandshake(&Handshake{PrivateKey: priv}).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8095", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	client.SetHandshake(&Handshake{PublicKey: pub})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	data, err := client.Request(ctx, []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	impostor, err := NewAxTcpClient("localhost:8095", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	impostor.SetHandler(nil)
+	impostor.SetHandshake(&Handshake{PublicKey: otherPub})
+	assert.ErrorIs(t, impostor.Connect(), ErrHandshakeFailed)
+}
+
+func TestHandshake_ServerKeyWithAES(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8111).WithAES(key).WithHandshake(&Handshake{PrivateKey: priv}).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8111", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	client.SetHandshake(&Handshake{PublicKey: pub})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	data, err := client.Request(ctx, []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	anonymous, err := NewAxTcpClient("localhost:8111", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	anonymous.SetHandler(nil)
+	anonymous.SetHandshake(&Handshake{PublicKey: pub})
+	assert.NotNil(t, anonymous.Connect())
+}
+
+func TestHandshake_RejectsPlaintext(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	calls := make(chan string, 1)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		calls <- string(d)
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8118).WithAES(key).WithHandshake(&Handshake{}).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	conn, err := net.Dial("tcp", "localhost:8118")
+	require.Nil(t, err)
+	defer conn.Close()
+	_, err = (&Handshake{Secret: key}).client(conn, time.Second, nil)
+	require.Nil(t, err)
+	plain, err := NewAxBinProcessor(zerolog.Nop()).Marshal([]byte("plain"))
+	require.Nil(t, err)
+	frames, err := dataFrames(plain)
+	require.Nil(t, err)
+	_, err = conn.Write(frames[0])
+	require.Nil(t, err)
+
+	// the server drops the connection without calling the handler
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Len(t, calls, 0)
+}
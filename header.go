@@ -0,0 +1,41 @@
+package axtransport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
+)
+
+// Packet versions select which PPacket fields are authenticated by AES-GCM.
+// Version 0 seals the payload and, when present, the replay timestamp and
+// nonce. Version 1 also binds the header: version, compression, encryption,
+// key id, request id, timestamp and nonce.
+const (
+	PacketVersionLegacy        uint32 = 0
+	PacketVersionAuthenticated uint32 = 1
+)
+
+var (
+	ErrPacketVersion = errors.New("unsupported packet version")
+	ErrNotEncrypted  = errors.New("packet is not encrypted")
+)
+
+func packetAdditionalData(pck *protobuf.PPacket) ([]byte, error) {
+	switch pck.Version {
+	case PacketVersionLegacy:
+		return replayAdditionalData(pck.Timestamp, pck.Nonce), nil
+	case PacketVersionAuthenticated:
+		res := make([]byte, 0, 36+len(pck.Nonce))
+		res = binary.BigEndian.AppendUint32(res, pck.Version)
+		res = binary.BigEndian.AppendUint32(res, uint32(pck.Compression))
+		res = binary.BigEndian.AppendUint32(res, uint32(pck.Encryption))
+		res = binary.BigEndian.AppendUint32(res, pck.KeyId)
+		res = binary.BigEndian.AppendUint64(res, pck.RequestId)
+		res = binary.BigEndian.AppendUint64(res, uint64(pck.Timestamp))
+		res = binary.BigEndian.AppendUint32(res, uint32(len(pck.Nonce)))
+		return append(res, pck.Nonce...), nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrPacketVersion, pck.Version)
+	}
+}
@@ -0,0 +1,69 @@
+package axtransport
+
+import (
+	"bytes"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/golang/protobuf/proto"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAxBinProcessor_AuthenticatedHeader(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	payload := bytes.Repeat([]byte("header "), 300)
+	newBin := func(version, min uint32) *AxBinProcessor {
+		bin := NewAxBinProcessor(zerolog.Nop()).WithPacketVersion(version).WithMinPacketVersion(min)
+		bin.WithAES(key)
+		bin.WithCompressionSize(100)
+		return bin
+	}
+	client := newBin(PacketVersionAuthenticated, PacketVersionLegacy)
+	migrating := newBin(PacketVersionLegacy, PacketVersionLegacy)
+	strict := newBin(PacketVersionAuthenticated, PacketVersionAuthenticated)
+
+	data, err := client.Marshal(payload)
+	require.Nil(t, err)
+	res, err := migrating.Unmarshal(data)
+	require.Nil(t, err)
+	assert.Equal(t, payload, res)
+
+	// flipping the compression flag is detected by the GCM tag
+	var pck protobuf.PPacket
+	require.Nil(t, proto.Unmarshal(data, &pck))
+	assert.Equal(t, protobuf.PCompression_P_COMPRESSION_GZIP, pck.Compression)
+	pck.Compression = protobuf.PCompression_P_COMPRESSION_NONE
+	tampered, err := proto.Marshal(&pck)
+	require.Nil(t, err)
+	_, err = migrating.Unmarshal(tampered)
+	assert.NotNil(t, err)
+
+	// downgrading the version changes the additional data as well
+	pck.Compression = protobuf.PCompression_P_COMPRESSION_GZIP
+	pck.Version = PacketVersionLegacy
+	tampered, err = proto.Marshal(&pck)
+	require.Nil(t, err)
+	_, err = migrating.Unmarshal(tampered)
+	assert.NotNil(t, err)
+
+	// legacy clients keep working until the minimum version is raised
+	legacy := newBin(PacketVersionLegacy, PacketVersionLegacy)
+	data, err = legacy.Marshal(payload)
+	require.Nil(t, err)
+	_, err = migrating.Unmarshal(data)
+	assert.Nil(t, err)
+	_, err = strict.Unmarshal(data)
+	assert.ErrorIs(t, err, ErrPacketVersion)
+
+	plain, err := proto.Marshal(&protobuf.PPacket{Payload: []byte("plain"), Version: PacketVersionAuthenticated})
+	require.Nil(t, err)
+	_, err = strict.Unmarshal(plain)
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	// replies keep the version of the request
+	data, err = migrating.MarshalPacket(&protobuf.PPacket{Payload: []byte("reply"), Version: PacketVersionAuthenticated})
+	require.Nil(t, err)
+	require.Nil(t, proto.Unmarshal(data, &pck))
+	assert.Equal(t, PacketVersionAuthenticated, pck.Version)
+}
@@ -0,0 +1,63 @@
+package axtransport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAxTcpClient_HeartbeatKeepsIdleConnection(t *testing.T) {
+	called := make(chan struct{}, 10)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		called <- struct{}{}
+		return d, nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8104).
+		WithTCPConnectionTimeout(300 * time.Millisecond).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8104", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	client.SetHeartbeat(100*time.Millisecond, 3)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	time.Sleep(700 * time.Millisecond)
+	assert.Equal(t, 0, len(called))
+	assert.Greater(t, client.Latency(), time.Duration(0))
+	data, err := client.Request(context.Background(), []byte("alive"))
+	require.Nil(t, err)
+	assert.Equal(t, "alive", string(data))
+}
+
+func TestAxTcpClient_HeartbeatDetectsDeadServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:8105")
+	require.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		// accept and never answer
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	client, err := NewAxTcpClient("localhost:8105", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	client.SetHeartbeat(50*time.Millisecond, 2)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	assert.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,251 @@
+package axtransport
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/golang/protobuf/proto"
+	"net"
+	"slices"
+	"time"
+)
+
+var (
+	ErrIncompatible      = errors.New("incompatible peer")
+	ErrHelloNotSupported = errors.New("bin processor does not support hello")
+)
+
+// HelloHeader carries the hello over HTTP: the client capabilities on the
+// request, the negotiated configuration on the response.
+const HelloHeader = "X-Ax-Hello"
+
+// Capabilities are advertised in the hello exchange. Compressions are in
+// order of preference, no compression is always acceptable. A zero
+// MaxMessageSize means no limit.
+type Capabilities struct {
+	Version         uint32
+	MinVersion      uint32
+	Compressions    []protobuf.PCompression
+	Encryptions     []protobuf.PEncryption
+	MaxMessageSize  int
+	CompressionSize int
+}
+
+// Negotiated is the configuration both sides settled on.
+type Negotiated struct {
+	Version         uint32
+	Compression     protobuf.PCompression
+	Encryption      protobuf.PEncryption
+	MaxMessageSize  int
+	CompressionSize int
+}
+
+// HelloBinProcessor is implemented by bin processors that can take part in
+// the hello exchange.
+type HelloBinProcessor interface {
+	BinProcessor
+	Capabilities() Capabilities
+	WithNegotiated(n Negotiated) BinProcessor
+}
+
+// negotiate settles on a configuration. Where both sides have a choice the
+// server preference wins.
+func negotiate(client, server Capabilities) (Negotiated, error) {
+	res := Negotiated{Version: min(client.Version, server.Version)}
+	if res.Version < client.MinVersion || res.Version < server.MinVersion {
+		return res, fmt.Errorf("%w: packet version client %d-%d, server %d-%d", ErrIncompatible,
+			client.MinVersion, client.Version, server.MinVersion, server.Version)
+	}
+	for _, c := range server.Compressions {
+		if slices.Contains(client.Compressions, c) {
+			res.Compression = c
+			res.CompressionSize = server.CompressionSize
+			break
+		}
+	}
+	i := slices.IndexFunc(server.Encryptions, func(e protobuf.PEncryption) bool {
+		return slices.Contains(client.Encryptions, e)
+	})
+	if i < 0 {
+		return res, fmt.Errorf("%w: encryption client %v, server %v", ErrIncompatible, client.Encryptions, server.Encryptions)
+	}
+	res.Encryption = server.Encryptions[i]
+	res.MaxMessageSize = client.MaxMessageSize
+	if res.MaxMessageSize == 0 || server.MaxMessageSize != 0 && server.MaxMessageSize < res.MaxMessageSize {
+		res.MaxMessageSize = server.MaxMessageSize
+	}
+	return res, nil
+}
+
+// accepts checks a configuration chosen by the server.
+func (c Capabilities) accepts(n Negotiated) error {
+	switch {
+	case n.Version < c.MinVersion || n.Version > c.Version:
+		return fmt.Errorf("%w: packet version %d", ErrIncompatible, n.Version)
+	case n.Compression != protobuf.PCompression_P_COMPRESSION_NONE && !slices.Contains(c.Compressions, n.Compression):
+		return fmt.Errorf("%w: compression %s", ErrIncompatible, n.Compression)
+	case !slices.Contains(c.Encryptions, n.Encryption):
+		return fmt.Errorf("%w: encryption %s", ErrIncompatible, n.Encryption)
+	}
+	return nil
+}
+
+func (c Capabilities) proto() *protobuf.PHello {
+	return &protobuf.PHello{
+		Version:         c.Version,
+		MinVersion:      c.MinVersion,
+		Compressions:    c.Compressions,
+		Encryptions:     c.Encryptions,
+		MaxMessageSize:  uint32(c.MaxMessageSize),
+		CompressionSize: uint32(c.CompressionSize),
+	}
+}
+
+func capabilitiesFromProto(h *protobuf.PHello) Capabilities {
+	return Capabilities{
+		Version:         h.Version,
+		MinVersion:      h.MinVersion,
+		Compressions:    h.Compressions,
+		Encryptions:     h.Encryptions,
+		MaxMessageSize:  int(h.MaxMessageSize),
+		CompressionSize: int(h.CompressionSize),
+	}
+}
+
+func (n Negotiated) proto() *protobuf.PHello {
+	return &protobuf.PHello{
+		Version:         n.Version,
+		MinVersion:      n.Version,
+		Compressions:    []protobuf.PCompression{n.Compression},
+		Encryptions:     []protobuf.PEncryption{n.Encryption},
+		MaxMessageSize:  uint32(n.MaxMessageSize),
+		CompressionSize: uint32(n.CompressionSize),
+	}
+}
+
+func negotiatedFromProto(h *protobuf.PHello) (Negotiated, error) {
+	if len(h.Compressions) != 1 || len(h.Encryptions) != 1 {
+		return Negotiated{}, fmt.Errorf("%w: bad hello reply", ErrIncompatible)
+	}
+	return Negotiated{
+		Version:         h.Version,
+		Compression:     h.Compressions[0],
+		Encryption:      h.Encryptions[0],
+		MaxMessageSize:  int(h.MaxMessageSize),
+		CompressionSize: int(h.CompressionSize),
+	}, nil
+}
+
+func encodeHello(h *protobuf.PHello) (string, error) {
+	data, err := proto.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeHello(s string) (*protobuf.PHello, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var h protobuf.PHello
+	if err = proto.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func helloBinProcessor(bin BinProcessor) (HelloBinProcessor, error) {
+	h, ok := bin.(HelloBinProcessor)
+	if !ok {
+		return nil, ErrHelloNotSupported
+	}
+	return h, nil
+}
+
+// helloTranscript encodes both sides of a hello exchange. The handshake
+// authenticates it, so a man in the middle can't downgrade the hello.
+func helloTranscript(client Capabilities, n Negotiated) ([]byte, error) {
+	req, err := proto.Marshal(client.proto())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := proto.Marshal(n.proto())
+	if err != nil {
+		return nil, err
+	}
+	return append(addSize32(req), addSize32(resp)...), nil
+}
+
+// helloClient runs the client side of the hello exchange and returns the
+// negotiated processor together with the hello transcript.
+func helloClient(conn net.Conn, timeout time.Duration, bin BinProcessor, maxMessageSize int) (BinProcessor, Negotiated, []byte, error) {
+	h, err := helloBinProcessor(bin)
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	caps := h.Capabilities()
+	caps.MaxMessageSize = maxMessageSize
+	if err = writeControl(conn, timeout, &protobuf.PControl{Type: protobuf.PControlType_P_CONTROL_HELLO, Hello: caps.proto()}); err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	c, err := readControl(conn, timeout)
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	switch {
+	case c.Type == protobuf.PControlType_P_CONTROL_ERROR && c.Error != nil:
+		return nil, Negotiated{}, nil, &RemoteError{Code: c.Error.Code, Message: c.Error.Message}
+	case c.Type != protobuf.PControlType_P_CONTROL_HELLO || c.Hello == nil:
+		return nil, Negotiated{}, nil, fmt.Errorf("%w: hello expected", ErrIncompatible)
+	}
+	n, err := negotiatedFromProto(c.Hello)
+	if err == nil {
+		err = caps.accepts(n)
+	}
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	hello, err := helloTranscript(caps, n)
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	return h.WithNegotiated(n), n, hello, nil
+}
+
+// helloServer runs the server side of the hello exchange and returns the
+// negotiated processor together with the hello transcript.
+func helloServer(conn net.Conn, timeout time.Duration, bin BinProcessor, maxMessageSize int) (BinProcessor, Negotiated, []byte, error) {
+	h, err := helloBinProcessor(bin)
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	c, err := readControl(conn, timeout)
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	if c.Type != protobuf.PControlType_P_CONTROL_HELLO || c.Hello == nil {
+		return nil, Negotiated{}, nil, fmt.Errorf("%w: hello expected", ErrIncompatible)
+	}
+	caps := h.Capabilities()
+	caps.MaxMessageSize = maxMessageSize
+	clientCaps := capabilitiesFromProto(c.Hello)
+	n, err := negotiate(clientCaps, caps)
+	if err != nil {
+		_ = writeControl(conn, timeout, &protobuf.PControl{
+			Type:  protobuf.PControlType_P_CONTROL_ERROR,
+			Error: &protobuf.PError{Code: protobuf.PErrorCode_P_ERROR_INCOMPATIBLE, Message: err.Error()},
+		})
+		return nil, Negotiated{}, nil, err
+	}
+	hello, err := helloTranscript(clientCaps, n)
+	if err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	if err = writeControl(conn, timeout, &protobuf.PControl{Type: protobuf.PControlType_P_CONTROL_HELLO, Hello: n.proto()}); err != nil {
+		return nil, Negotiated{}, nil, err
+	}
+	return h.WithNegotiated(n), n, hello, nil
+}
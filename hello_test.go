@@ -0,0 +1,219 @@
+package axtransport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	gzip, zlib := protobuf.PCompression_P_COMPRESSION_GZIP, protobuf.PCompression_P_COMPRESSION_ZLIB
+	aes, none := protobuf.PEncryption_P_ENCRYPTION_AES, protobuf.PEncryption_P_ENCRYPTION_NONE
+	client := Capabilities{
+		Version:        PacketVersionAuthenticated,
+		Compressions:   []protobuf.PCompression{gzip, zlib},
+		Encryptions:    []protobuf.PEncryption{aes},
+		MaxMessageSize: 1000,
+	}
+	server := Capabilities{
+		Version:         PacketVersionAuthenticated,
+		Compressions:    []protobuf.PCompression{zlib, gzip},
+		Encryptions:     []protobuf.PEncryption{aes},
+		MaxMessageSize:  500,
+		CompressionSize: 100,
+	}
+	n, err := negotiate(client, server)
+	require.Nil(t, err)
+	assert.Equal(t, Negotiated{
+		Version:         PacketVersionAuthenticated,
+		Compression:     zlib,
+		Encryption:      aes,
+		MaxMessageSize:  500,
+		CompressionSize: 100,
+	}, n)
+	assert.Nil(t, client.accepts(n))
+
+	server.Compressions = nil
+	n, err = negotiate(client, server)
+	require.Nil(t, err)
+	assert.Equal(t, protobuf.PCompression_P_COMPRESSION_NONE, n.Compression)
+	assert.Equal(t, 0, n.CompressionSize)
+
+	server.Encryptions = []protobuf.PEncryption{none}
+	_, err = negotiate(client, server)
+	assert.ErrorIs(t, err, ErrIncompatible)
+
+	server.Encryptions = []protobuf.PEncryption{aes}
+	client.Version = PacketVersionLegacy
+	server.MinVersion = PacketVersionAuthenticated
+	_, err = negotiate(client, server)
+	assert.ErrorIs(t, err, ErrIncompatible)
+}
+
+func TestAxTcp_Hello(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8109).
+		WithAES(key).
+		WithHello().
+		WithHandshake(&Handshake{}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8109", key, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	client.SetHello(true)
+	client.SetHandshake(&Handshake{})
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	n, ok := client.Negotiated()
+	require.True(t, ok)
+	assert.Equal(t, protobuf.PEncryption_P_ENCRYPTION_AES, n.Encryption)
+	assert.Equal(t, protobuf.PCompression_P_COMPRESSION_GZIP, n.Compression)
+	assert.Equal(t, PacketVersionAuthenticated, n.Version)
+	assert.Equal(t, MaxMessageSize, n.MaxMessageSize)
+	data, err := client.Request(context.Background(), []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	plain, err := NewAxTcpClient("localhost:8109", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	plain.SetHandler(nil)
+	plain.SetHello(true)
+	err = plain.Connect()
+	assert.ErrorIs(t, err, ErrIncompatible)
+	assert.False(t, plain.IsConnected())
+}
+
+func TestAxTcp_HelloBroadcast(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithTCPServer("localhost", 8116).WithHello().WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	pushes := make(chan string, 1)
+	client, err := NewAxTcpClient("localhost:8116", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		pushes <- string(data)
+		return nil
+	})
+	client.SetHello(true)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	_, err = client.Request(context.Background(), []byte("ready"))
+	require.Nil(t, err)
+
+	// the negotiated version is above the default version of the server
+	require.Nil(t, transport.Broadcast([]byte("push")))
+	assert.Equal(t, "push", waitString(t, pushes))
+	assert.True(t, client.IsConnected())
+}
+
+func TestAxHttp_Hello(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8090).
+		WithAES(key).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client := NewAxHttpClientBuilder().WithAES(key).Build()
+	n, err := client.Hello(context.Background(), "http://localhost:8090/api")
+	require.Nil(t, err)
+	assert.Equal(t, protobuf.PEncryption_P_ENCRYPTION_AES, n.Encryption)
+	assert.Equal(t, protobuf.PCompression_P_COMPRESSION_GZIP, n.Compression)
+	data, err := client.Post("http://localhost:8090/api", []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, err = NewAxHttpClient(nil).Hello(context.Background(), "http://localhost:8090/api")
+	var statusErr *HttpStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotAcceptable, statusErr.StatusCode)
+	assert.Contains(t, string(statusErr.Body), "encryption")
+}
+
+func TestHello_Downgrade(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	bin := NewAxBinProcessor(zerolog.Nop()).WithPacketVersion(PacketVersionAuthenticated)
+	bin.WithAES(key)
+	legacy := bin.Capabilities()
+	legacy.Version, legacy.MinVersion = PacketVersionLegacy, PacketVersionLegacy
+	_, err := negotiate(legacy, bin.Capabilities())
+	assert.ErrorIs(t, err, ErrIncompatible)
+
+	// a rewritten client hello changes the transcript the handshake authenticates
+	n, err := negotiate(bin.Capabilities(), bin.Capabilities())
+	require.Nil(t, err)
+	clientHello, err := helloTranscript(bin.Capabilities(), n)
+	require.Nil(t, err)
+	stripped := bin.Capabilities()
+	stripped.Compressions = nil
+	serverHello, err := helloTranscript(stripped, n)
+	require.Nil(t, err)
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	handshake := &Handshake{Secret: key}
+	go func() {
+		_, _ = handshake.server(serverConn, time.Second, serverHello)
+		_ = serverConn.Close()
+	}()
+	_, err = handshake.client(clientConn, time.Second, clientHello)
+	assert.NotNil(t, err)
+
+	// once AES is negotiated plaintext packets are rejected
+	negotiated := bin.WithNegotiated(n)
+	plain, err := NewAxBinProcessor(zerolog.Nop()).WithPacketVersion(PacketVersionAuthenticated).Marshal([]byte("hello"))
+	require.Nil(t, err)
+	_, err = negotiated.Unmarshal(plain)
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+}
+
+func TestAxHttp_HelloRejectsPlaintext(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().WithHTTPServer("localhost", 8117).WithAES(key).WithDataHandlerFunc(f).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	aesBin := NewAxBinProcessor(zerolog.Nop())
+	aesBin.WithAES(key)
+	caps := aesBin.Capabilities()
+	hello, err := encodeHello(caps.proto())
+	require.Nil(t, err)
+	body, err := NewAxBinProcessor(zerolog.Nop()).WithPacketVersion(PacketVersionAuthenticated).Marshal([]byte("plain"))
+	require.Nil(t, err)
+	req, err := http.NewRequest("POST", "http://localhost:8117/api", bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set(HelloHeader, hello)
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
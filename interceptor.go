@@ -0,0 +1,88 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+	"runtime/debug"
+	"time"
+)
+
+// Interceptor wraps the DataHandlerFunc of every transport. It gets the
+// decoded payload and must call next to continue the chain.
+type Interceptor func(data []byte, ctx context.Context, peer *Peer, next DataHandlerFunc) ([]byte, error)
+
+var ErrHandlerPanic = errors.New("handler panic")
+
+var opsHandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "ax_transport",
+	Name:      "handler_duration",
+	Help:      "Handler duration",
+	Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+}, []string{"transport", "status"})
+
+// intercept wraps handler so that interceptors run in the order they were
+// added.
+func intercept(interceptors []Interceptor, handler DataHandlerFunc, peer *Peer) DataHandlerFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, next := interceptors[i], handler
+		handler = func(data []byte, ctx context.Context) ([]byte, error) {
+			return ic(data, ctx, peer, next)
+		}
+	}
+	return handler
+}
+
+// Recovery turns a handler panic into an error wrapping ErrHandlerPanic.
+func Recovery(logger zerolog.Logger) Interceptor {
+	return func(data []byte, ctx context.Context, peer *Peer, next DataHandlerFunc) (res []byte, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error().
+					Str("transport", peer.Transport).
+					Str("remote", peer.RemoteAddr).
+					Bytes("stack", debug.Stack()).
+					Msgf("handler panic: %v", r)
+				res, err = nil, fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+			}
+		}()
+		return next(data, ctx)
+	}
+}
+
+// Logging logs every request, failed ones at error level.
+func Logging(logger zerolog.Logger) Interceptor {
+	return func(data []byte, ctx context.Context, peer *Peer, next DataHandlerFunc) ([]byte, error) {
+		startTime := time.Now()
+		res, err := next(data, ctx)
+		ev := logger.Debug()
+		if err != nil {
+			ev = logger.Error().Err(err)
+		}
+		ev.Str("transport", peer.Transport).
+			Str("remote", peer.RemoteAddr).
+			Uint64("connection", peer.ConnectionId).
+			Int("request-size", len(data)).
+			Int("response-size", len(res)).
+			Dur("duration", time.Since(startTime)).
+			Msg("request")
+		return res, err
+	}
+}
+
+// Timing observes the handler duration per transport and status.
+func Timing() Interceptor {
+	return func(data []byte, ctx context.Context, peer *Peer, next DataHandlerFunc) ([]byte, error) {
+		startTime := time.Now()
+		res, err := next(data, ctx)
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		opsHandlerDuration.WithLabelValues(peer.Transport, status).Observe(time.Since(startTime).Seconds())
+		return res, err
+	}
+}
@@ -0,0 +1,78 @@
+package axtransport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntercept_Order(t *testing.T) {
+	var calls []string
+	named := func(name string) Interceptor {
+		return func(data []byte, ctx context.Context, peer *Peer, next DataHandlerFunc) ([]byte, error) {
+			calls = append(calls, name)
+			res, err := next(append(data, name...), ctx)
+			calls = append(calls, "/"+name)
+			return res, err
+		}
+	}
+	handler := intercept([]Interceptor{named("a"), named("b")}, func(data []byte, ctx context.Context) ([]byte, error) {
+		calls = append(calls, "handler")
+		return data, nil
+	}, &Peer{Transport: "test"})
+	res, err := handler([]byte(">"), context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, ">ab", string(res))
+	assert.Equal(t, []string{"a", "b", "handler", "/b", "/a"}, calls)
+}
+
+func TestIntercept_Recovery(t *testing.T) {
+	handler := intercept([]Interceptor{Recovery(zerolog.Nop()), Logging(zerolog.Nop()), Timing()}, func(data []byte, ctx context.Context) ([]byte, error) {
+		panic("boom")
+	}, &Peer{Transport: "test"})
+	_, err := handler([]byte("data"), context.Background())
+	assert.ErrorIs(t, err, ErrHandlerPanic)
+}
+
+func TestBuilder_Use(t *testing.T) {
+	peers := make(chan Peer, 2)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		if string(d) == "panic" {
+			panic("boom")
+		}
+		return d, nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8098).
+		Use(Recovery(zerolog.Nop()), func(data []byte, ctx context.Context, peer *Peer, next DataHandlerFunc) ([]byte, error) {
+			peers <- *peer
+			return next(data, ctx)
+		}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8098", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	data, err := client.Request(context.Background(), []byte("test"))
+	require.Nil(t, err)
+	assert.Equal(t, "test", string(data))
+	peer := <-peers
+	assert.Equal(t, "tcp", peer.Transport)
+	assert.Equal(t, transport.Connections(), []uint64{peer.ConnectionId})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = client.Request(ctx, []byte("panic"))
+	assert.NotNil(t, err)
+	<-peers
+}
@@ -4,8 +4,11 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 )
 
+var ErrShortCiphertext = errors.New("ciphertext too short")
+
 type AES struct {
 	secretKey []byte
 }
@@ -15,6 +18,16 @@ func NewAES(secretKey []byte) *AES {
 }
 
 func (a *AES) Encrypt(data []byte) ([]byte, error) {
+	return a.EncryptWithData(data, nil)
+}
+
+func (a *AES) Decrypt(cipherData []byte) ([]byte, error) {
+	return a.DecryptWithData(cipherData, nil)
+}
+
+// EncryptWithData seals data and authenticates additionalData, which is not
+// encrypted but must be passed unchanged to DecryptWithData.
+func (a *AES) EncryptWithData(data, additionalData []byte) ([]byte, error) {
 	aesInst, err := aes.NewCipher(a.secretKey)
 	if err != nil {
 		return nil, err
@@ -36,11 +49,11 @@ func (a *AES) Encrypt(data []byte) ([]byte, error) {
 	// ciphertext here is actually nonce+ciphertext
 	// So that when we decrypt, just knowing the nonce size
 	// is enough to separate it from the ciphertext.
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	ciphertext := gcm.Seal(nonce, nonce, data, additionalData)
 	return ciphertext, nil
 }
 
-func (a *AES) Decrypt(cipherData []byte) ([]byte, error) {
+func (a *AES) DecryptWithData(cipherData, additionalData []byte) ([]byte, error) {
 	aesInst, err := aes.NewCipher(a.secretKey)
 	if err != nil {
 		return nil, err
@@ -54,9 +67,12 @@ func (a *AES) Decrypt(cipherData []byte) ([]byte, error) {
 	// Since we know the ciphertext is actually nonce+ciphertext
 	// And len(nonce) == NonceSize(). We can separate the two.
 	nonceSize := gcm.NonceSize()
+	if len(cipherData) < nonceSize {
+		return nil, ErrShortCiphertext
+	}
 	nonce, ciphertext := cipherData[:nonceSize], cipherData[nonceSize:]
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+)
+
+func InflateData(data []byte) (resData []byte, err error) {
+	r := flate.NewReader(bytes.NewBuffer(data))
+	defer r.Close()
+	var resB bytes.Buffer
+	_, err = resB.ReadFrom(r)
+	if err != nil {
+		return
+	}
+	resData = resB.Bytes()
+	return
+}
+
+func DeflateData(data []byte) (compressedData []byte, err error) {
+	var b bytes.Buffer
+	fl, err := flate.NewWriter(&b, flate.DefaultCompression)
+	if err != nil {
+		return
+	}
+	_, err = fl.Write(data)
+	if err != nil {
+		return
+	}
+	if err = fl.Close(); err != nil {
+		return
+	}
+	compressedData = b.Bytes()
+	return
+}
+
+func UnzlibData(data []byte) (resData []byte, err error) {
+	var r io.ReadCloser
+	r, err = zlib.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	var resB bytes.Buffer
+	_, err = resB.ReadFrom(r)
+	if err != nil {
+		return
+	}
+	resData = resB.Bytes()
+	return
+}
+
+func ZlibData(data []byte) (compressedData []byte, err error) {
+	var b bytes.Buffer
+	zl := zlib.NewWriter(&b)
+	_, err = zl.Write(data)
+	if err != nil {
+		return
+	}
+	if err = zl.Close(); err != nil {
+		return
+	}
+	compressedData = b.Bytes()
+	return
+}
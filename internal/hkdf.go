@@ -0,0 +1,18 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// HKDF32 derives a 32 byte key with HKDF-SHA256 (RFC 5869). A single
+// expand block is enough for the output length.
+func HKDF32(secret, salt, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
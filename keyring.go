@@ -0,0 +1,109 @@
+package axtransport
+
+import (
+	"errors"
+	"fmt"
+	"github.com/axgrid/axtransport/internal"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown aes key")
+	ErrRetireActive = errors.New("can't retire active aes key")
+	ErrInvalidKey   = errors.New("invalid aes key size")
+)
+
+// Keyring holds the AES keys accepted by an AxBinProcessor. Packets are
+// encrypted with the active key and decrypted with the key named by their
+// key_id, so peers using an older key keep working until it is retired.
+type Keyring struct {
+	mu        sync.RWMutex
+	keys      map[uint32]*internal.AES
+	active    uint32
+	hasActive bool
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[uint32]*internal.AES)}
+}
+
+func (k *Keyring) Add(id uint32, secretKey []byte) error {
+	switch len(secretKey) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("%w: %d", ErrInvalidKey, len(secretKey))
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = internal.NewAES(secretKey)
+	return nil
+}
+
+func (k *Keyring) Activate(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownKey, id)
+	}
+	k.active, k.hasActive = id, true
+	return nil
+}
+
+// activateDefault activates id unless another key is already active.
+func (k *Keyring) activateDefault(id uint32) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; ok && !k.hasActive {
+		k.active, k.hasActive = id, true
+	}
+}
+
+func (k *Keyring) Retire(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownKey, id)
+	}
+	if k.hasActive && k.active == id {
+		return ErrRetireActive
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+func (k *Keyring) ActiveID() (uint32, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, k.hasActive
+}
+
+func (k *Keyring) IDs() []uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	res := make([]uint32, 0, len(k.keys))
+	for id := range k.keys {
+		res = append(res, id)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+func (k *Keyring) activeKey() (uint32, *internal.AES, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if !k.hasActive {
+		return 0, nil, false
+	}
+	return k.active, k.keys[k.active], true
+}
+
+func (k *Keyring) key(id uint32) (*internal.AES, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	aes, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, id)
+	}
+	return aes, nil
+}
@@ -0,0 +1,77 @@
+package axtransport
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey := []byte("12345678901234567890123456789012")
+	newKey := []byte("abcdefghijklmnopqrstuvwxyz012345")
+
+	server := NewAxBinProcessor(zerolog.Nop()).WithKeyring(NewKeyring())
+	require.Nil(t, server.Keyring().Add(1, oldKey))
+	require.Nil(t, server.Keyring().Activate(1))
+	oldClient := NewAxBinProcessor(zerolog.Nop()).WithKeyring(NewKeyring())
+	require.Nil(t, oldClient.Keyring().Add(1, oldKey))
+	require.Nil(t, oldClient.Keyring().Activate(1))
+
+	// rotation window: the server accepts both keys and answers with the new one
+	require.Nil(t, server.Keyring().Add(2, newKey))
+	require.Nil(t, server.Keyring().Activate(2))
+	newClient := NewAxBinProcessor(zerolog.Nop()).WithKeyring(NewKeyring())
+	require.Nil(t, newClient.Keyring().Add(2, newKey))
+	require.Nil(t, newClient.Keyring().Activate(2))
+
+	for _, client := range []*AxBinProcessor{oldClient, newClient} {
+		data, err := client.Marshal([]byte("hello"))
+		require.Nil(t, err)
+		data, err = server.Unmarshal(data)
+		require.Nil(t, err)
+		assert.Equal(t, "hello", string(data))
+	}
+	data, err := server.Marshal([]byte("reply"))
+	require.Nil(t, err)
+	data, err = newClient.Unmarshal(data)
+	require.Nil(t, err)
+	assert.Equal(t, "reply", string(data))
+
+	assert.ErrorIs(t, server.Keyring().Retire(2), ErrRetireActive)
+	require.Nil(t, server.Keyring().Retire(1))
+	assert.Equal(t, []uint32{2}, server.Keyring().IDs())
+	data, err = oldClient.Marshal([]byte("hello"))
+	require.Nil(t, err)
+	_, err = server.Unmarshal(data)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	assert.ErrorIs(t, server.Keyring().Add(3, []byte("short")), ErrInvalidKey)
+}
+
+func TestBuilder_KeyringWithAES(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	keyring := NewKeyring()
+	require.Nil(t, keyring.Add(2, []byte("abcdefghijklmnopqrstuvwxyz012345")))
+	require.Nil(t, keyring.Activate(2))
+	AxTransport().WithTCPServer("localhost", 8112).WithKeyring(keyring).WithAES(key).Build()
+	id, ok := keyring.ActiveID()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(2), id)
+	assert.Equal(t, []uint32{0, 2}, keyring.IDs())
+
+	bin := NewAxBinProcessor(zerolog.Nop())
+	bin.WithAES(key)
+	id, ok = bin.Keyring().ActiveID()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(0), id)
+}
+
+func TestAxBinProcessor_InvalidAESKey(t *testing.T) {
+	bin := NewAxBinProcessor(zerolog.Nop())
+	bin.WithAES([]byte("short key"))
+	_, err := bin.Marshal([]byte("secret"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = bin.Unmarshal([]byte{})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
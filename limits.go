@@ -0,0 +1,131 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OverLimitAction decides what happens when a concurrency limit is reached.
+type OverLimitAction int
+
+const (
+	// OverLimitWait stops accepting connections, or stops reading from the
+	// connection, until a slot is free.
+	OverLimitWait OverLimitAction = iota
+	// OverLimitReject closes new connections right after accept and answers
+	// requests with an error control frame.
+	OverLimitReject
+)
+
+func (a OverLimitAction) String() string {
+	switch a {
+	case OverLimitWait:
+		return "wait"
+	case OverLimitReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// ConcurrencyLimits bounds the resources of AxTcp and AxWebSocket, each
+// transport has its own slots. Zero means unlimited.
+type ConcurrencyLimits struct {
+	MaxConnections int
+	// MaxInFlight is the number of handler calls running for one connection.
+	MaxInFlight int
+	// Workers is the number of handler calls running for all connections.
+	Workers int
+	Action  OverLimitAction
+}
+
+var ErrOverloaded = errors.New("overloaded")
+
+var (
+	opsInFlightCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ax_transport",
+		Name:      "tcp_in_flight",
+		Help:      "TCP handler calls in flight",
+	})
+
+	opsOverLimitCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ax_transport",
+		Name:      "over_limit_count",
+		Help:      "Connections and requests over a concurrency limit",
+	}, []string{"limit", "action"})
+)
+
+// semaphore is unlimited when nil.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) tryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+type limitSlot struct {
+	limit string
+	sem   semaphore
+}
+
+// acquireSlots takes a slot of every semaphore in order, or none of them.
+func acquireSlots(ctx context.Context, action OverLimitAction, slots ...limitSlot) error {
+	for i, slot := range slots {
+		if slot.sem.tryAcquire() {
+			continue
+		}
+		opsOverLimitCount.WithLabelValues(slot.limit, action.String()).Inc()
+		err := ErrOverloaded
+		if action == OverLimitWait {
+			err = slot.sem.acquire(ctx)
+		}
+		if err != nil {
+			for _, acquired := range slots[:i] {
+				acquired.sem.release()
+			}
+			return fmt.Errorf("%s: %w", slot.limit, err)
+		}
+	}
+	return nil
+}
+
+func releaseSlots(slots ...limitSlot) {
+	for _, slot := range slots {
+		slot.sem.release()
+	}
+}
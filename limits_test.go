@@ -0,0 +1,70 @@
+package axtransport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireSlots(t *testing.T) {
+	first, second := newSemaphore(2), newSemaphore(1)
+	slots := []limitSlot{{"first", first}, {"second", second}}
+	require.Nil(t, acquireSlots(context.Background(), OverLimitReject, slots...))
+	assert.ErrorIs(t, acquireSlots(context.Background(), OverLimitReject, slots...), ErrOverloaded)
+	assert.Equal(t, 1, len(first))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, acquireSlots(ctx, OverLimitWait, slots...), context.DeadlineExceeded)
+
+	releaseSlots(slots...)
+	assert.Equal(t, 0, len(first))
+	assert.Equal(t, 0, len(second))
+	assert.Nil(t, acquireSlots(context.Background(), OverLimitReject, limitSlot{"unlimited", newSemaphore(0)}))
+}
+
+func TestBuilder_WithConcurrencyLimits(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		time.Sleep(200 * time.Millisecond)
+		return d, nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8102).
+		WithConcurrencyLimits(ConcurrencyLimits{MaxConnections: 1, MaxInFlight: 1, Action: OverLimitReject}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8102", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Request(context.Background(), []byte("slow"))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_, err = client.Request(context.Background(), []byte("overloaded"))
+	assert.ErrorIs(t, err, ErrOverloaded)
+	assert.Nil(t, <-done)
+
+	refused, err := NewAxTcpClient("localhost:8102", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	refused.SetHandler(nil)
+	if err = refused.Connect(); err == nil {
+		defer refused.Disconnect()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = refused.Request(ctx, []byte("refused"))
+	}
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(transport.Connections()))
+}
@@ -0,0 +1,48 @@
+package axtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// Peer describes the remote side of a request. Handlers get it with
+// PeerFromContext.
+type Peer struct {
+	Transport    string
+	RemoteAddr   string
+	ConnectionId uint64
+	// Session is the X-Ax-Session header of HTTP requests.
+	Session string
+	TLS     *tls.ConnectionState
+	// Header is set for HTTP requests and WebSocket upgrades.
+	Header http.Header
+}
+
+type peerKey struct{}
+
+func withPeer(ctx context.Context, peer *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, peer)
+}
+
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	peer, ok := ctx.Value(peerKey{}).(*Peer)
+	return peer, ok
+}
+
+func connPeer(transport string, conn net.Conn, id uint64) *Peer {
+	peer := &Peer{
+		Transport:    transport,
+		RemoteAddr:   conn.RemoteAddr().String(),
+		ConnectionId: id,
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		peer.TLS = &state
+	}
+	return peer
+}
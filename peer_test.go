@@ -0,0 +1,53 @@
+package axtransport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerFromContext(t *testing.T) {
+	peers := make(chan *Peer, 1)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		peer, ok := PeerFromContext(ctx)
+		assert.True(t, ok)
+		assert.NotNil(t, ctx.Done())
+		peers <- peer
+		return d, nil
+	}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8086).
+		WithTCPServer("localhost", 8100).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	httpClient := NewAxHttpClient(nil)
+	_, err := httpClient.Post("http://localhost:8086/api", []byte("http"))
+	require.Nil(t, err)
+	peer := <-peers
+	assert.Equal(t, "http", peer.Transport)
+	assert.NotEmpty(t, peer.RemoteAddr)
+	assert.Equal(t, httpClient.Session(), peer.Session)
+	assert.Equal(t, httpClient.Session(), peer.Header.Get(SessionHeader))
+	assert.Nil(t, peer.TLS)
+
+	tcpClient, err := NewAxTcpClient("localhost:8100", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	tcpClient.SetHandler(nil)
+	require.Nil(t, tcpClient.Connect())
+	defer tcpClient.Disconnect()
+	_, err = tcpClient.Request(context.Background(), []byte("tcp"))
+	require.Nil(t, err)
+	peer = <-peers
+	assert.Equal(t, "tcp", peer.Transport)
+	assert.Equal(t, []uint64{peer.ConnectionId}, transport.Connections())
+	assert.Nil(t, peer.Header)
+
+	_, ok := PeerFromContext(context.Background())
+	assert.False(t, ok)
+}
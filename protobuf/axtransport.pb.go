@@ -23,8 +23,12 @@ const (
 type PCompression int32
 
 const (
-	PCompression_P_COMPRESSION_NONE PCompression = 0
-	PCompression_P_COMPRESSION_GZIP PCompression = 1
+	PCompression_P_COMPRESSION_NONE    PCompression = 0
+	PCompression_P_COMPRESSION_GZIP    PCompression = 1
+	PCompression_P_COMPRESSION_DEFLATE PCompression = 2
+	PCompression_P_COMPRESSION_ZLIB    PCompression = 3
+	PCompression_P_COMPRESSION_SNAPPY  PCompression = 4
+	PCompression_P_COMPRESSION_ZSTD    PCompression = 5
 )
 
 // Enum value maps for PCompression.
@@ -32,10 +36,18 @@ var (
 	PCompression_name = map[int32]string{
 		0: "P_COMPRESSION_NONE",
 		1: "P_COMPRESSION_GZIP",
+		2: "P_COMPRESSION_DEFLATE",
+		3: "P_COMPRESSION_ZLIB",
+		4: "P_COMPRESSION_SNAPPY",
+		5: "P_COMPRESSION_ZSTD",
 	}
 	PCompression_value = map[string]int32{
-		"P_COMPRESSION_NONE": 0,
-		"P_COMPRESSION_GZIP": 1,
+		"P_COMPRESSION_NONE":    0,
+		"P_COMPRESSION_GZIP":    1,
+		"P_COMPRESSION_DEFLATE": 2,
+		"P_COMPRESSION_ZLIB":    3,
+		"P_COMPRESSION_SNAPPY":  4,
+		"P_COMPRESSION_ZSTD":    5,
 	}
 )
 
@@ -112,6 +124,128 @@ func (PEncryption) EnumDescriptor() ([]byte, []int) {
 	return file_axtransport_proto_rawDescGZIP(), []int{1}
 }
 
+type PControlType int32
+
+const (
+	PControlType_P_CONTROL_NONE      PControlType = 0
+	PControlType_P_CONTROL_HANDSHAKE PControlType = 1
+	PControlType_P_CONTROL_CHUNK     PControlType = 2
+	PControlType_P_CONTROL_ERROR     PControlType = 3
+	PControlType_P_CONTROL_PING      PControlType = 4
+	PControlType_P_CONTROL_PONG      PControlType = 5
+	PControlType_P_CONTROL_HELLO     PControlType = 6
+)
+
+// Enum value maps for PControlType.
+var (
+	PControlType_name = map[int32]string{
+		0: "P_CONTROL_NONE",
+		1: "P_CONTROL_HANDSHAKE",
+		2: "P_CONTROL_CHUNK",
+		3: "P_CONTROL_ERROR",
+		4: "P_CONTROL_PING",
+		5: "P_CONTROL_PONG",
+		6: "P_CONTROL_HELLO",
+	}
+	PControlType_value = map[string]int32{
+		"P_CONTROL_NONE":      0,
+		"P_CONTROL_HANDSHAKE": 1,
+		"P_CONTROL_CHUNK":     2,
+		"P_CONTROL_ERROR":     3,
+		"P_CONTROL_PING":      4,
+		"P_CONTROL_PONG":      5,
+		"P_CONTROL_HELLO":     6,
+	}
+)
+
+func (x PControlType) Enum() *PControlType {
+	p := new(PControlType)
+	*p = x
+	return p
+}
+
+func (x PControlType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PControlType) Descriptor() protoreflect.EnumDescriptor {
+	return file_axtransport_proto_enumTypes[2].Descriptor()
+}
+
+func (PControlType) Type() protoreflect.EnumType {
+	return &file_axtransport_proto_enumTypes[2]
+}
+
+func (x PControlType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PControlType.Descriptor instead.
+func (PControlType) EnumDescriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{2}
+}
+
+type PErrorCode int32
+
+const (
+	PErrorCode_P_ERROR_NONE           PErrorCode = 0
+	PErrorCode_P_ERROR_UNKNOWN_METHOD PErrorCode = 1
+	PErrorCode_P_ERROR_BAD_REQUEST    PErrorCode = 2
+	PErrorCode_P_ERROR_INTERNAL       PErrorCode = 3
+	PErrorCode_P_ERROR_RATE_LIMITED   PErrorCode = 4
+	PErrorCode_P_ERROR_OVERLOADED     PErrorCode = 5
+	PErrorCode_P_ERROR_INCOMPATIBLE   PErrorCode = 6
+)
+
+// Enum value maps for PErrorCode.
+var (
+	PErrorCode_name = map[int32]string{
+		0: "P_ERROR_NONE",
+		1: "P_ERROR_UNKNOWN_METHOD",
+		2: "P_ERROR_BAD_REQUEST",
+		3: "P_ERROR_INTERNAL",
+		4: "P_ERROR_RATE_LIMITED",
+		5: "P_ERROR_OVERLOADED",
+		6: "P_ERROR_INCOMPATIBLE",
+	}
+	PErrorCode_value = map[string]int32{
+		"P_ERROR_NONE":           0,
+		"P_ERROR_UNKNOWN_METHOD": 1,
+		"P_ERROR_BAD_REQUEST":    2,
+		"P_ERROR_INTERNAL":       3,
+		"P_ERROR_RATE_LIMITED":   4,
+		"P_ERROR_OVERLOADED":     5,
+		"P_ERROR_INCOMPATIBLE":   6,
+	}
+)
+
+func (x PErrorCode) Enum() *PErrorCode {
+	p := new(PErrorCode)
+	*p = x
+	return p
+}
+
+func (x PErrorCode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PErrorCode) Descriptor() protoreflect.EnumDescriptor {
+	return file_axtransport_proto_enumTypes[3].Descriptor()
+}
+
+func (PErrorCode) Type() protoreflect.EnumType {
+	return &file_axtransport_proto_enumTypes[3]
+}
+
+func (x PErrorCode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PErrorCode.Descriptor instead.
+func (PErrorCode) EnumDescriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{3}
+}
+
 type PPacket struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -120,6 +254,11 @@ type PPacket struct {
 	Payload     []byte       `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
 	Compression PCompression `protobuf:"varint,2,opt,name=compression,proto3,enum=com.axgrid.axtransport.PCompression" json:"compression,omitempty"`
 	Encryption  PEncryption  `protobuf:"varint,3,opt,name=encryption,proto3,enum=com.axgrid.axtransport.PEncryption" json:"encryption,omitempty"`
+	RequestId   uint64       `protobuf:"varint,4,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	KeyId       uint32       `protobuf:"varint,5,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	Timestamp   int64        `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Nonce       []byte       `protobuf:"bytes,7,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Version     uint32       `protobuf:"varint,8,opt,name=version,proto3" json:"version,omitempty"`
 }
 
 func (x *PPacket) Reset() {
@@ -175,12 +314,520 @@ func (x *PPacket) GetEncryption() PEncryption {
 	return PEncryption_P_ENCRYPTION_NONE
 }
 
+func (x *PPacket) GetRequestId() uint64 {
+	if x != nil {
+		return x.RequestId
+	}
+	return 0
+}
+
+func (x *PPacket) GetKeyId() uint32 {
+	if x != nil {
+		return x.KeyId
+	}
+	return 0
+}
+
+func (x *PPacket) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *PPacket) GetNonce() []byte {
+	if x != nil {
+		return x.Nonce
+	}
+	return nil
+}
+
+func (x *PPacket) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type PHandshake struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PublicKey []byte `protobuf:"bytes,1,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	Signature []byte `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (x *PHandshake) Reset() {
+	*x = PHandshake{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PHandshake) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PHandshake) ProtoMessage() {}
+
+func (x *PHandshake) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PHandshake.ProtoReflect.Descriptor instead.
+func (*PHandshake) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PHandshake) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+func (x *PHandshake) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type PHello struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version         uint32         `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	MinVersion      uint32         `protobuf:"varint,2,opt,name=min_version,json=minVersion,proto3" json:"min_version,omitempty"`
+	Compressions    []PCompression `protobuf:"varint,3,rep,packed,name=compressions,proto3,enum=com.axgrid.axtransport.PCompression" json:"compressions,omitempty"`
+	Encryptions     []PEncryption  `protobuf:"varint,4,rep,packed,name=encryptions,proto3,enum=com.axgrid.axtransport.PEncryption" json:"encryptions,omitempty"`
+	MaxMessageSize  uint32         `protobuf:"varint,5,opt,name=max_message_size,json=maxMessageSize,proto3" json:"max_message_size,omitempty"`
+	CompressionSize uint32         `protobuf:"varint,6,opt,name=compression_size,json=compressionSize,proto3" json:"compression_size,omitempty"`
+}
+
+func (x *PHello) Reset() {
+	*x = PHello{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PHello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PHello) ProtoMessage() {}
+
+func (x *PHello) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PHello.ProtoReflect.Descriptor instead.
+func (*PHello) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PHello) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *PHello) GetMinVersion() uint32 {
+	if x != nil {
+		return x.MinVersion
+	}
+	return 0
+}
+
+func (x *PHello) GetCompressions() []PCompression {
+	if x != nil {
+		return x.Compressions
+	}
+	return nil
+}
+
+func (x *PHello) GetEncryptions() []PEncryption {
+	if x != nil {
+		return x.Encryptions
+	}
+	return nil
+}
+
+func (x *PHello) GetMaxMessageSize() uint32 {
+	if x != nil {
+		return x.MaxMessageSize
+	}
+	return 0
+}
+
+func (x *PHello) GetCompressionSize() uint32 {
+	if x != nil {
+		return x.CompressionSize
+	}
+	return 0
+}
+
+type PChunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	MessageId uint64 `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Index     uint32 `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	Count     uint32 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	Data      []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *PChunk) Reset() {
+	*x = PChunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PChunk) ProtoMessage() {}
+
+func (x *PChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PChunk.ProtoReflect.Descriptor instead.
+func (*PChunk) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PChunk) GetMessageId() uint64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *PChunk) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *PChunk) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *PChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type PControl struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type      PControlType `protobuf:"varint,1,opt,name=type,proto3,enum=com.axgrid.axtransport.PControlType" json:"type,omitempty"`
+	Handshake *PHandshake  `protobuf:"bytes,2,opt,name=handshake,proto3" json:"handshake,omitempty"`
+	Chunk     *PChunk      `protobuf:"bytes,3,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	Error     *PError      `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	RequestId uint64       `protobuf:"varint,5,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Timestamp int64        `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Hello     *PHello      `protobuf:"bytes,7,opt,name=hello,proto3" json:"hello,omitempty"`
+}
+
+func (x *PControl) Reset() {
+	*x = PControl{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PControl) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PControl) ProtoMessage() {}
+
+func (x *PControl) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PControl.ProtoReflect.Descriptor instead.
+func (*PControl) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PControl) GetType() PControlType {
+	if x != nil {
+		return x.Type
+	}
+	return PControlType_P_CONTROL_NONE
+}
+
+func (x *PControl) GetHandshake() *PHandshake {
+	if x != nil {
+		return x.Handshake
+	}
+	return nil
+}
+
+func (x *PControl) GetChunk() *PChunk {
+	if x != nil {
+		return x.Chunk
+	}
+	return nil
+}
+
+func (x *PControl) GetError() *PError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *PControl) GetRequestId() uint64 {
+	if x != nil {
+		return x.RequestId
+	}
+	return 0
+}
+
+func (x *PControl) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *PControl) GetHello() *PHello {
+	if x != nil {
+		return x.Hello
+	}
+	return nil
+}
+
+type PError struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Code    PErrorCode `protobuf:"varint,1,opt,name=code,proto3,enum=com.axgrid.axtransport.PErrorCode" json:"code,omitempty"`
+	Message string     `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *PError) Reset() {
+	*x = PError{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PError) ProtoMessage() {}
+
+func (x *PError) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PError.ProtoReflect.Descriptor instead.
+func (*PError) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PError) GetCode() PErrorCode {
+	if x != nil {
+		return x.Code
+	}
+	return PErrorCode_P_ERROR_NONE
+}
+
+func (x *PError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type PCall struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Method  string `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	Payload []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+}
+
+func (x *PCall) Reset() {
+	*x = PCall{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PCall) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PCall) ProtoMessage() {}
+
+func (x *PCall) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PCall.ProtoReflect.Descriptor instead.
+func (*PCall) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PCall) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *PCall) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type PResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Payload []byte  `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	Error   *PError `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *PResult) Reset() {
+	*x = PResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_axtransport_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PResult) ProtoMessage() {}
+
+func (x *PResult) ProtoReflect() protoreflect.Message {
+	mi := &file_axtransport_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PResult.ProtoReflect.Descriptor instead.
+func (*PResult) Descriptor() ([]byte, []int) {
+	return file_axtransport_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PResult) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *PResult) GetError() *PError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
 var File_axtransport_proto protoreflect.FileDescriptor
 
 var file_axtransport_proto_rawDesc = []byte{
 	0x0a, 0x11, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x70, 0x72,
 	0x6f, 0x74, 0x6f, 0x12, 0x16, 0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e,
-	0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x22, 0xb0, 0x01, 0x0a, 0x07,
+	0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x22, 0xb4, 0x02, 0x0a, 0x07,
 	0x50, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f,
 	0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61,
 	0x64, 0x12, 0x46, 0x0a, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e,
@@ -191,20 +838,124 @@ var file_axtransport_proto_rawDesc = []byte{
 	0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x23, 0x2e,
 	0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61,
 	0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69,
-	0x6f, 0x6e, 0x52, 0x0a, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x2a, 0x3e,
-	0x0a, 0x0c, 0x50, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16,
-	0x0a, 0x12, 0x50, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f,
-	0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x16, 0x0a, 0x12, 0x50, 0x5f, 0x43, 0x4f, 0x4d, 0x50,
-	0x52, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x47, 0x5a, 0x49, 0x50, 0x10, 0x01, 0x2a, 0x3a,
-	0x0a, 0x0b, 0x50, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x15, 0x0a,
-	0x11, 0x50, 0x5f, 0x45, 0x4e, 0x43, 0x52, 0x59, 0x50, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x4e, 0x4f,
-	0x4e, 0x45, 0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x50, 0x5f, 0x45, 0x4e, 0x43, 0x52, 0x59, 0x50,
-	0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x41, 0x45, 0x53, 0x10, 0x01, 0x42, 0x3e, 0x0a, 0x16, 0x63, 0x6f,
-	0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73,
-	0x70, 0x6f, 0x72, 0x74, 0x50, 0x01, 0xaa, 0x02, 0x21, 0x41, 0x78, 0x47, 0x72, 0x69, 0x64, 0x2e,
-	0x49, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41,
-	0x78, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x33,
+	0x6f, 0x6e, 0x52, 0x0a, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1d,
+	0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x15, 0x0a,
+	0x06, 0x6b, 0x65, 0x79, 0x5f, 0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6b,
+	0x65, 0x79, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x22, 0x49, 0x0a, 0x0a, 0x50, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x12, 0x1d, 0x0a, 0x0a, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65, 0x79, 0x12,
+	0x1c, 0x0a, 0x09, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x09, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0xa9, 0x02,
+	0x0a, 0x06, 0x50, 0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x69, 0x6e, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x6d, 0x69, 0x6e, 0x56, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x48, 0x0a, 0x0c, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69,
+	0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x24, 0x2e, 0x63, 0x6f, 0x6d, 0x2e,
+	0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f,
+	0x72, 0x74, 0x2e, 0x50, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52,
+	0x0c, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x45, 0x0a,
+	0x0b, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x04, 0x20, 0x03,
+	0x28, 0x0e, 0x32, 0x23, 0x2e, 0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e,
+	0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x45, 0x6e, 0x63,
+	0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x12, 0x28, 0x0a, 0x10, 0x6d, 0x61, 0x78, 0x5f, 0x6d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e,
+	0x6d, 0x61, 0x78, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x29,
+	0x0a, 0x10, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x5f, 0x73, 0x69,
+	0x7a, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x53, 0x69, 0x7a, 0x65, 0x22, 0x67, 0x0a, 0x06, 0x50, 0x43, 0x68,
+	0x75, 0x6e, 0x6b, 0x12, 0x1d, 0x0a, 0x0a, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x49, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e,
+	0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61,
+	0x74, 0x61, 0x22, 0xe5, 0x02, 0x0a, 0x08, 0x50, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x12,
+	0x38, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x24, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61,
+	0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x54,
+	0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x40, 0x0a, 0x09, 0x68, 0x61, 0x6e,
+	0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x52, 0x09, 0x68, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x12, 0x34, 0x0a, 0x05, 0x63,
+	0x68, 0x75, 0x6e, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70,
+	0x6f, 0x72, 0x74, 0x2e, 0x50, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x52, 0x05, 0x63, 0x68, 0x75, 0x6e,
+	0x6b, 0x12, 0x34, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1e, 0x2e, 0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78,
+	0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x45, 0x72, 0x72, 0x6f, 0x72,
+	0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x12, 0x34, 0x0a, 0x05, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64,
+	0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x48, 0x65,
+	0x6c, 0x6c, 0x6f, 0x52, 0x05, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x22, 0x5a, 0x0a, 0x06, 0x50, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x12, 0x36, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x22, 0x2e, 0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e,
+	0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50, 0x45, 0x72, 0x72,
+	0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x39, 0x0a, 0x05, 0x50, 0x43, 0x61, 0x6c, 0x6c, 0x12,
+	0x16, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f,
+	0x61, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61,
+	0x64, 0x22, 0x59, 0x0a, 0x07, 0x50, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x18, 0x0a, 0x07,
+	0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70,
+	0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x34, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x63, 0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72,
+	0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50,
+	0x45, 0x72, 0x72, 0x6f, 0x72, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x2a, 0xa3, 0x01, 0x0a,
+	0x0c, 0x50, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a,
+	0x12, 0x50, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x4e,
+	0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x16, 0x0a, 0x12, 0x50, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52,
+	0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x47, 0x5a, 0x49, 0x50, 0x10, 0x01, 0x12, 0x19, 0x0a,
+	0x15, 0x50, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x44,
+	0x45, 0x46, 0x4c, 0x41, 0x54, 0x45, 0x10, 0x02, 0x12, 0x16, 0x0a, 0x12, 0x50, 0x5f, 0x43, 0x4f,
+	0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x5a, 0x4c, 0x49, 0x42, 0x10, 0x03,
+	0x12, 0x18, 0x0a, 0x14, 0x50, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49, 0x4f,
+	0x4e, 0x5f, 0x53, 0x4e, 0x41, 0x50, 0x50, 0x59, 0x10, 0x04, 0x12, 0x16, 0x0a, 0x12, 0x50, 0x5f,
+	0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x5a, 0x53, 0x54, 0x44,
+	0x10, 0x05, 0x2a, 0x3a, 0x0a, 0x0b, 0x50, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x15, 0x0a, 0x11, 0x50, 0x5f, 0x45, 0x4e, 0x43, 0x52, 0x59, 0x50, 0x54, 0x49, 0x4f,
+	0x4e, 0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x50, 0x5f, 0x45, 0x4e,
+	0x43, 0x52, 0x59, 0x50, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x41, 0x45, 0x53, 0x10, 0x01, 0x2a, 0xa2,
+	0x01, 0x0a, 0x0c, 0x50, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12,
+	0x12, 0x0a, 0x0e, 0x50, 0x5f, 0x43, 0x4f, 0x4e, 0x54, 0x52, 0x4f, 0x4c, 0x5f, 0x4e, 0x4f, 0x4e,
+	0x45, 0x10, 0x00, 0x12, 0x17, 0x0a, 0x13, 0x50, 0x5f, 0x43, 0x4f, 0x4e, 0x54, 0x52, 0x4f, 0x4c,
+	0x5f, 0x48, 0x41, 0x4e, 0x44, 0x53, 0x48, 0x41, 0x4b, 0x45, 0x10, 0x01, 0x12, 0x13, 0x0a, 0x0f,
+	0x50, 0x5f, 0x43, 0x4f, 0x4e, 0x54, 0x52, 0x4f, 0x4c, 0x5f, 0x43, 0x48, 0x55, 0x4e, 0x4b, 0x10,
+	0x02, 0x12, 0x13, 0x0a, 0x0f, 0x50, 0x5f, 0x43, 0x4f, 0x4e, 0x54, 0x52, 0x4f, 0x4c, 0x5f, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x10, 0x03, 0x12, 0x12, 0x0a, 0x0e, 0x50, 0x5f, 0x43, 0x4f, 0x4e, 0x54,
+	0x52, 0x4f, 0x4c, 0x5f, 0x50, 0x49, 0x4e, 0x47, 0x10, 0x04, 0x12, 0x12, 0x0a, 0x0e, 0x50, 0x5f,
+	0x43, 0x4f, 0x4e, 0x54, 0x52, 0x4f, 0x4c, 0x5f, 0x50, 0x4f, 0x4e, 0x47, 0x10, 0x05, 0x12, 0x13,
+	0x0a, 0x0f, 0x50, 0x5f, 0x43, 0x4f, 0x4e, 0x54, 0x52, 0x4f, 0x4c, 0x5f, 0x48, 0x45, 0x4c, 0x4c,
+	0x4f, 0x10, 0x06, 0x2a, 0xb5, 0x01, 0x0a, 0x0a, 0x50, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f,
+	0x64, 0x65, 0x12, 0x10, 0x0a, 0x0c, 0x50, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x4e, 0x4f,
+	0x4e, 0x45, 0x10, 0x00, 0x12, 0x1a, 0x0a, 0x16, 0x50, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f,
+	0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x5f, 0x4d, 0x45, 0x54, 0x48, 0x4f, 0x44, 0x10, 0x01,
+	0x12, 0x17, 0x0a, 0x13, 0x50, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x42, 0x41, 0x44, 0x5f,
+	0x52, 0x45, 0x51, 0x55, 0x45, 0x53, 0x54, 0x10, 0x02, 0x12, 0x14, 0x0a, 0x10, 0x50, 0x5f, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x5f, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x4e, 0x41, 0x4c, 0x10, 0x03, 0x12,
+	0x18, 0x0a, 0x14, 0x50, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x52, 0x41, 0x54, 0x45, 0x5f,
+	0x4c, 0x49, 0x4d, 0x49, 0x54, 0x45, 0x44, 0x10, 0x04, 0x12, 0x16, 0x0a, 0x12, 0x50, 0x5f, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x5f, 0x4f, 0x56, 0x45, 0x52, 0x4c, 0x4f, 0x41, 0x44, 0x45, 0x44, 0x10,
+	0x05, 0x12, 0x18, 0x0a, 0x14, 0x50, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x49, 0x4e, 0x43,
+	0x4f, 0x4d, 0x50, 0x41, 0x54, 0x49, 0x42, 0x4c, 0x45, 0x10, 0x06, 0x42, 0x3e, 0x0a, 0x16, 0x63,
+	0x6f, 0x6d, 0x2e, 0x61, 0x78, 0x67, 0x72, 0x69, 0x64, 0x2e, 0x61, 0x78, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x70, 0x6f, 0x72, 0x74, 0x50, 0x01, 0xaa, 0x02, 0x21, 0x41, 0x78, 0x47, 0x72, 0x69, 0x64,
+	0x2e, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x41, 0x78, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -219,21 +970,39 @@ func file_axtransport_proto_rawDescGZIP() []byte {
 	return file_axtransport_proto_rawDescData
 }
 
-var file_axtransport_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_axtransport_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_axtransport_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_axtransport_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_axtransport_proto_goTypes = []interface{}{
-	(PCompression)(0), // 0: com.axgrid.axtransport.PCompression
-	(PEncryption)(0),  // 1: com.axgrid.axtransport.PEncryption
-	(*PPacket)(nil),   // 2: com.axgrid.axtransport.PPacket
+	(PCompression)(0),  // 0: com.axgrid.axtransport.PCompression
+	(PEncryption)(0),   // 1: com.axgrid.axtransport.PEncryption
+	(PControlType)(0),  // 2: com.axgrid.axtransport.PControlType
+	(PErrorCode)(0),    // 3: com.axgrid.axtransport.PErrorCode
+	(*PPacket)(nil),    // 4: com.axgrid.axtransport.PPacket
+	(*PHandshake)(nil), // 5: com.axgrid.axtransport.PHandshake
+	(*PHello)(nil),     // 6: com.axgrid.axtransport.PHello
+	(*PChunk)(nil),     // 7: com.axgrid.axtransport.PChunk
+	(*PControl)(nil),   // 8: com.axgrid.axtransport.PControl
+	(*PError)(nil),     // 9: com.axgrid.axtransport.PError
+	(*PCall)(nil),      // 10: com.axgrid.axtransport.PCall
+	(*PResult)(nil),    // 11: com.axgrid.axtransport.PResult
 }
 var file_axtransport_proto_depIdxs = []int32{
-	0, // 0: com.axgrid.axtransport.PPacket.compression:type_name -> com.axgrid.axtransport.PCompression
-	1, // 1: com.axgrid.axtransport.PPacket.encryption:type_name -> com.axgrid.axtransport.PEncryption
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	0,  // 0: com.axgrid.axtransport.PPacket.compression:type_name -> com.axgrid.axtransport.PCompression
+	1,  // 1: com.axgrid.axtransport.PPacket.encryption:type_name -> com.axgrid.axtransport.PEncryption
+	0,  // 2: com.axgrid.axtransport.PHello.compressions:type_name -> com.axgrid.axtransport.PCompression
+	1,  // 3: com.axgrid.axtransport.PHello.encryptions:type_name -> com.axgrid.axtransport.PEncryption
+	2,  // 4: com.axgrid.axtransport.PControl.type:type_name -> com.axgrid.axtransport.PControlType
+	5,  // 5: com.axgrid.axtransport.PControl.handshake:type_name -> com.axgrid.axtransport.PHandshake
+	7,  // 6: com.axgrid.axtransport.PControl.chunk:type_name -> com.axgrid.axtransport.PChunk
+	9,  // 7: com.axgrid.axtransport.PControl.error:type_name -> com.axgrid.axtransport.PError
+	6,  // 8: com.axgrid.axtransport.PControl.hello:type_name -> com.axgrid.axtransport.PHello
+	3,  // 9: com.axgrid.axtransport.PError.code:type_name -> com.axgrid.axtransport.PErrorCode
+	9,  // 10: com.axgrid.axtransport.PResult.error:type_name -> com.axgrid.axtransport.PError
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_axtransport_proto_init() }
@@ -254,14 +1023,98 @@ func file_axtransport_proto_init() {
 				return nil
 			}
 		}
+		file_axtransport_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PHandshake); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_axtransport_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PHello); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_axtransport_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PChunk); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_axtransport_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PControl); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_axtransport_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PError); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_axtransport_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PCall); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_axtransport_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_axtransport_proto_rawDesc,
-			NumEnums:      2,
-			NumMessages:   1,
+			NumEnums:      4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
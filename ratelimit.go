@@ -0,0 +1,195 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimitAction decides what happens to a request over a rate limit.
+type RateLimitAction int
+
+const (
+	// RateLimitDelay waits for a token. On TCP it stops reading from the
+	// connection meanwhile.
+	RateLimitDelay RateLimitAction = iota
+	// RateLimitReject answers with an error control frame on TCP and with
+	// 429 on HTTP. WebSocket drops the message.
+	RateLimitReject
+	// RateLimitDisconnect closes the TCP or WebSocket connection. HTTP
+	// answers 429 and closes the connection.
+	RateLimitDisconnect
+)
+
+func (a RateLimitAction) String() string {
+	switch a {
+	case RateLimitDelay:
+		return "delay"
+	case RateLimitReject:
+		return "reject"
+	case RateLimitDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// RateLimit is a token bucket of Rate requests per second. A zero Rate
+// disables it.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) limiter() *rate.Limiter {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := l.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(l.Rate), burst)
+}
+
+// RateLimits configures a RateLimiter. PerConnection applies to TCP and
+// WebSocket connections.
+type RateLimits struct {
+	PerConnection RateLimit
+	PerIP         RateLimit
+	Global        RateLimit
+	Action        RateLimitAction
+}
+
+var ErrRateLimited = errors.New("rate limited")
+
+var opsRateLimitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ax_transport",
+	Name:      "rate_limited_count",
+	Help:      "Requests over a rate limit",
+}, []string{"transport", "scope", "action"})
+
+const rateLimitIPIdle = 5 * time.Minute
+
+// RateLimiter holds the per IP and global buckets. Share one between
+// transports to limit them together.
+type RateLimiter struct {
+	limits    RateLimits
+	global    *rate.Limiter
+	mu        sync.Mutex
+	ips       map[string]*ipLimiter
+	lastSweep time.Time
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:    limits,
+		global:    limits.Global.limiter(),
+		ips:       make(map[string]*ipLimiter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *RateLimiter) Action() RateLimitAction {
+	return l.limits.Action
+}
+
+// connLimiter returns a bucket for a new connection, or nil.
+func (l *RateLimiter) connLimiter() *rate.Limiter {
+	return l.limits.PerConnection.limiter()
+}
+
+func (l *RateLimiter) ipLimiter(addr string) *rate.Limiter {
+	if l.limits.PerIP.Rate <= 0 {
+		return nil
+	}
+	ip := addr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		ip = host
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) > rateLimitIPIdle {
+		for k, v := range l.ips {
+			if now.Sub(v.lastSeen) > rateLimitIPIdle {
+				delete(l.ips, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	entry, ok := l.ips[ip]
+	if !ok {
+		entry = &ipLimiter{limiter: l.limits.PerIP.limiter()}
+		l.ips[ip] = entry
+	}
+	entry.lastSeen = now
+	return entry.limiter
+}
+
+// take takes a token from the connection, IP and global buckets. With
+// RateLimitDelay it waits for ctx, otherwise it fails with ErrRateLimited.
+// The returned scope names the bucket that was empty. A request that is not
+// let through gives its tokens back to every bucket.
+func (l *RateLimiter) take(ctx context.Context, transport string, conn *rate.Limiter, addr string) (string, error) {
+	buckets := []struct {
+		scope   string
+		limiter *rate.Limiter
+	}{
+		{"connection", conn},
+		{"ip", l.ipLimiter(addr)},
+		{"global", l.global},
+	}
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(buckets))
+	// cancel at the reservation time, so tokens taken at once come back too
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	var scope string
+	var wait time.Duration
+	for _, b := range buckets {
+		if b.limiter == nil {
+			continue
+		}
+		r := b.limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		delay := r.DelayFrom(now)
+		if delay == 0 {
+			continue
+		}
+		opsRateLimitedCount.WithLabelValues(transport, b.scope, l.limits.Action.String()).Inc()
+		if l.limits.Action != RateLimitDelay {
+			cancel()
+			return b.scope, fmt.Errorf("%w: %s", ErrRateLimited, b.scope)
+		}
+		if delay > wait {
+			scope, wait = b.scope, delay
+		}
+	}
+	if wait == 0 {
+		return "", nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return "", nil
+	case <-ctx.Done():
+		cancel()
+		return scope, ctx.Err()
+	}
+}
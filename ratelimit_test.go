@@ -0,0 +1,125 @@
+package axtransport
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_Delay(t *testing.T) {
+	l := NewRateLimiter(RateLimits{PerIP: RateLimit{Rate: 20, Burst: 1}, Action: RateLimitDelay})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := l.take(context.Background(), "test", nil, "127.0.0.1:1000")
+		require.Nil(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	// other IPs have their own bucket
+	start = time.Now()
+	_, err := l.take(context.Background(), "test", nil, "127.0.0.2:1000")
+	require.Nil(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestRateLimiter_Reject(t *testing.T) {
+	l := NewRateLimiter(RateLimits{Global: RateLimit{Rate: 1, Burst: 2}, Action: RateLimitReject})
+	for i := 0; i < 2; i++ {
+		_, err := l.take(context.Background(), "test", nil, "127.0.0.1:1000")
+		require.Nil(t, err)
+	}
+	scope, err := l.take(context.Background(), "test", nil, "127.0.0.2:1000")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, "global", scope)
+}
+
+func TestBuilder_WithRateLimit(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8101).
+		WithHTTPServer("localhost", 8087).
+		WithRateLimit(RateLimits{PerIP: RateLimit{Rate: 0.1, Burst: 2}, Action: RateLimitReject}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8101", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	data, err := client.Request(context.Background(), []byte("first"))
+	require.Nil(t, err)
+	assert.Equal(t, "first", string(data))
+
+	httpClient := NewAxHttpClient(nil)
+	data, err = httpClient.Post("http://localhost:8087/api", []byte("second"))
+	require.Nil(t, err)
+	assert.Equal(t, "second", string(data))
+
+	_, err = client.Request(context.Background(), []byte("third"))
+	assert.ErrorIs(t, err, ErrRateLimited)
+	_, err = httpClient.Post("http://localhost:8087/api", []byte("fourth"))
+	assert.ErrorContains(t, err, "429")
+	assert.True(t, client.IsConnected())
+}
+
+func TestRateLimiter_RejectKeepsTokens(t *testing.T) {
+	l := NewRateLimiter(RateLimits{PerIP: RateLimit{Rate: 0.1, Burst: 1}, Global: RateLimit{Rate: 0.1, Burst: 1}, Action: RateLimitReject})
+	_, err := l.take(context.Background(), "test", nil, "127.0.0.1:1000")
+	require.Nil(t, err)
+	// the global bucket rejects, the IP bucket of 127.0.0.2 keeps its token
+	scope, err := l.take(context.Background(), "test", nil, "127.0.0.2:1000")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, "global", scope)
+	assert.Equal(t, 1.0, l.ipLimiter("127.0.0.2:1000").Tokens())
+}
+
+type countingBin struct {
+	customBin
+	unmarshals atomic.Int32
+}
+
+func (c *countingBin) WithCompressionSize(size int) BinProcessor {
+	return c
+}
+
+func (c *countingBin) Unmarshal(in []byte) ([]byte, error) {
+	c.unmarshals.Add(1)
+	return in, nil
+}
+
+func TestAxTcp_RateLimitBeforeDecode(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	bin := &countingBin{}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8123).
+		WithCustomBinProcessor(bin).
+		WithRateLimit(RateLimits{PerConnection: RateLimit{Rate: 0.1, Burst: 1}, Action: RateLimitDisconnect}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8123", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+	for _, m := range []string{"first", "second", "third"} {
+		require.Nil(t, client.Send([]byte(m)))
+	}
+	assert.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), bin.unmarshals.Load())
+}
@@ -0,0 +1,108 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"github.com/axgrid/axtransport/protobuf"
+	"math"
+	"math/rand"
+	"time"
+)
+
+var ErrOfflineQueueFull = errors.New("offline queue is full")
+
+// Backoff is an exponential delay between reconnect attempts. Jitter is the
+// random fraction, between 0 and 1, taken off every delay. A zero Min or Max
+// takes the value of DefaultBackoff.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	Jitter float64
+}
+
+var DefaultBackoff = Backoff{
+	Min:    100 * time.Millisecond,
+	Max:    30 * time.Second,
+	Factor: 2,
+	Jitter: 0.2,
+}
+
+func (b Backoff) delay(attempt int) time.Duration {
+	factor := b.Factor
+	if factor < 1 {
+		factor = 2
+	}
+	minDelay, maxDelay := b.Min, b.Max
+	if minDelay <= 0 {
+		minDelay = DefaultBackoff.Min
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultBackoff.Max
+	}
+	// clamp before converting, the power overflows int64 after a few dozen attempts
+	d := float64(minDelay) * math.Pow(factor, float64(attempt))
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if b.Jitter > 0 {
+		d -= d * b.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// SetReconnect makes the client reconnect after an established connection
+// fails. Data sent while disconnected is queued, up to queueSize packets, and
+// sent after reconnect. Disconnect stops reconnecting. A failed Connect is not
+// retried, the caller gets its error and calls Connect again.
+func (a *AxTcpClient) SetReconnect(backoff Backoff, queueSize int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reconnect = &backoff
+	a.offlineSize = queueSize
+}
+
+func (a *AxTcpClient) OnConnected(fn func()) {
+	a.onConnected = fn
+}
+
+// OnDisconnected is called with the failure, or nil after Disconnect.
+func (a *AxTcpClient) OnDisconnected(fn func(err error)) {
+	a.onDisconnected = fn
+}
+
+func (a *AxTcpClient) reconnectLoop(ctx context.Context) {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(a.reconnect.delay(attempt)):
+		}
+		err := a.connectContext(ctx)
+		if err == nil {
+			return
+		}
+		a.logger.Warn().Err(err).Int("attempt", attempt+1).Msg("reconnect failed")
+	}
+}
+
+func (a *AxTcpClient) enqueueOffline(pck *protobuf.PPacket) error {
+	if len(a.offline) >= a.offlineSize {
+		return ErrOfflineQueueFull
+	}
+	a.offline = append(a.offline, pck)
+	return nil
+}
+
+func (a *AxTcpClient) flushOffline() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.offline) > 0 {
+		if err := a.sendLocked(a.offline[0]); err != nil {
+			a.logger.Warn().Err(err).Int("queued", len(a.offline)).Msg("flush offline queue failed")
+			return
+		}
+		a.offline[0] = nil
+		a.offline = a.offline[1:]
+	}
+}
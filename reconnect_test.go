@@ -0,0 +1,91 @@
+package axtransport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Factor: 2}
+	assert.Equal(t, 100*time.Millisecond, b.delay(0))
+	assert.Equal(t, 400*time.Millisecond, b.delay(2))
+	assert.Equal(t, time.Second, b.delay(10))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.delay(1)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
+
+func TestBackoff_Defaults(t *testing.T) {
+	var zero Backoff
+	assert.Equal(t, DefaultBackoff.Min, zero.delay(0))
+	assert.Equal(t, DefaultBackoff.Max, zero.delay(100))
+
+	uncapped := Backoff{Min: time.Second, Factor: 2}
+	for attempt := 0; attempt < 2000; attempt += 37 {
+		d := uncapped.delay(attempt)
+		assert.Greater(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, DefaultBackoff.Max)
+	}
+}
+
+func TestAxTcpClient_Reconnect(t *testing.T) {
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		return d, nil
+	}
+	build := func() *Transport {
+		return AxTransport().WithTCPServer("localhost", 8106).WithDispatchMode(DispatchSequential, nil).WithDataHandlerFunc(f).Build()
+	}
+	transport := build()
+	require.Nil(t, transport.Start())
+
+	received := make(chan string, 10)
+	connected := make(chan struct{}, 10)
+	disconnected := make(chan error, 10)
+	client, err := NewAxTcpClient("localhost:8106", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(func(data []byte, ctx context.Context) error {
+		received <- string(data)
+		return nil
+	})
+	client.SetReconnect(Backoff{Min: 20 * time.Millisecond, Max: 100 * time.Millisecond}, 2)
+	client.OnConnected(func() { connected <- struct{}{} })
+	client.OnDisconnected(func(err error) { disconnected <- err })
+	require.Nil(t, client.Connect())
+	<-connected
+
+	transport.Stop()
+	select {
+	case err = <-disconnected:
+		assert.NotNil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for disconnect")
+	}
+	require.Nil(t, client.Send([]byte("first")))
+	require.Nil(t, client.Send([]byte("second")))
+	assert.ErrorIs(t, client.Send([]byte("third")), ErrOfflineQueueFull)
+
+	transport = build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+	select {
+	case <-connected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for reconnect")
+	}
+	assert.Equal(t, "first", waitString(t, received))
+	assert.Equal(t, "second", waitString(t, received))
+
+	require.Nil(t, client.Disconnect())
+	assert.Nil(t, <-disconnected)
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, client.IsConnected())
+}
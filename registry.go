@@ -0,0 +1,75 @@
+package axtransport
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var connectionIdSeq atomic.Uint64
+
+type connection interface {
+	ID() uint64
+	Write(data []byte) error
+}
+
+type connRegistry[T connection] struct {
+	mu    sync.RWMutex
+	conns map[uint64]T
+}
+
+func newConnRegistry[T connection]() *connRegistry[T] {
+	return &connRegistry[T]{conns: make(map[uint64]T)}
+}
+
+func (r *connRegistry[T]) add(conn T) {
+	r.mu.Lock()
+	r.conns[conn.ID()] = conn
+	r.mu.Unlock()
+}
+
+func (r *connRegistry[T]) remove(conn T) {
+	r.mu.Lock()
+	delete(r.conns, conn.ID())
+	r.mu.Unlock()
+}
+
+func (r *connRegistry[T]) get(id uint64) (T, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conn, ok := r.conns[id]
+	return conn, ok
+}
+
+func (r *connRegistry[T]) ids() []uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]uint64, 0, len(r.conns))
+	for id := range r.conns {
+		res = append(res, id)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+func (r *connRegistry[T]) all() []T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]T, 0, len(r.conns))
+	for _, conn := range r.conns {
+		res = append(res, conn)
+	}
+	return res
+}
+
+func (r *connRegistry[T]) broadcast(data []byte) error {
+	var errs []error
+	for _, conn := range r.all() {
+		if err := conn.Write(data); err != nil {
+			errs = append(errs, fmt.Errorf("connection %d: %w", conn.ID(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package axtransport
+
+import (
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/golang/protobuf/proto"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAxBinProcessor_ReplayProtection(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	client := NewAxBinProcessor(zerolog.Nop()).WithReplayProtection(time.Minute)
+	client.WithAES(key)
+	server := NewAxBinProcessor(zerolog.Nop()).WithReplayProtection(time.Minute)
+	server.WithAES(key)
+
+	data, err := client.Marshal([]byte("hello"))
+	require.Nil(t, err)
+	res, err := server.Unmarshal(data)
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(res))
+	_, err = server.Unmarshal(data)
+	assert.ErrorIs(t, err, ErrReplayDuplicate)
+
+	// the timestamp is authenticated, moving it invalidates the packet
+	var pck protobuf.PPacket
+	require.Nil(t, proto.Unmarshal(data, &pck))
+	pck.Timestamp++
+	pck.Nonce[0]++
+	tampered, err := proto.Marshal(&pck)
+	require.Nil(t, err)
+	_, err = server.Unmarshal(tampered)
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrReplayDuplicate)
+
+	data, err = client.Marshal([]byte("late"))
+	require.Nil(t, err)
+	server.replay.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = server.Unmarshal(data)
+	assert.ErrorIs(t, err, ErrReplayStale)
+
+	// peers without replay protection still understand stamped packets
+	plain := NewAxBinProcessor(zerolog.Nop())
+	plain.WithAES(key)
+	data, err = client.Marshal([]byte("compatible"))
+	require.Nil(t, err)
+	res, err = plain.Unmarshal(data)
+	require.Nil(t, err)
+	assert.Equal(t, "compatible", string(res))
+	data, err = plain.Marshal([]byte("unstamped"))
+	require.Nil(t, err)
+	_, err = server.Unmarshal(data)
+	assert.ErrorIs(t, err, ErrReplayNoNonce)
+}
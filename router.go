@@ -0,0 +1,135 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownMethod = errors.New("unknown method")
+
+// MethodError is the error reply of a Router. Handlers can return it to
+// choose the code the caller gets.
+type MethodError struct {
+	Method  string
+	Code    protobuf.PErrorCode
+	Message string
+}
+
+func (e *MethodError) Error() string {
+	return fmt.Sprintf("method %q: %s: %s", e.Method, e.Code, e.Message)
+}
+
+func (e *MethodError) Is(target error) bool {
+	return target == ErrUnknownMethod && e.Code == protobuf.PErrorCode_P_ERROR_UNKNOWN_METHOD
+}
+
+// Router dispatches PCall envelopes to handlers registered by method name.
+// Pass Router.Serve as the DataHandlerFunc of a transport.
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string]DataHandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]DataHandlerFunc)}
+}
+
+// HandleFunc registers a handler of raw payloads.
+func (r *Router) HandleFunc(method string, fn DataHandlerFunc) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[method] = fn
+	return r
+}
+
+func (r *Router) Methods() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]string, 0, len(r.handlers))
+	for method := range r.handlers {
+		res = append(res, method)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Handle registers a handler of protobuf messages, Req must be a pointer to
+// a generated message.
+func Handle[Req, Resp proto.Message](r *Router, method string, fn func(req Req, ctx context.Context) (Resp, error)) *Router {
+	reqType := reflect.TypeOf((*Req)(nil)).Elem().Elem()
+	return r.HandleFunc(method, func(data []byte, ctx context.Context) ([]byte, error) {
+		req := reflect.New(reqType).Interface().(Req)
+		if err := proto.Unmarshal(data, req); err != nil {
+			return nil, &MethodError{Method: method, Code: protobuf.PErrorCode_P_ERROR_BAD_REQUEST, Message: err.Error()}
+		}
+		resp, err := fn(req, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(resp)
+	})
+}
+
+func (r *Router) Serve(data []byte, ctx context.Context) ([]byte, error) {
+	var call protobuf.PCall
+	if err := proto.Unmarshal(data, &call); err != nil {
+		return resultReply(nil, &MethodError{Code: protobuf.PErrorCode_P_ERROR_BAD_REQUEST, Message: err.Error()})
+	}
+	r.mu.RLock()
+	fn, ok := r.handlers[call.Method]
+	r.mu.RUnlock()
+	if !ok {
+		return resultReply(nil, &MethodError{Method: call.Method, Code: protobuf.PErrorCode_P_ERROR_UNKNOWN_METHOD, Message: ErrUnknownMethod.Error()})
+	}
+	res, err := fn(call.Payload, ctx)
+	if err != nil {
+		var methodErr *MethodError
+		if !errors.As(err, &methodErr) {
+			methodErr = &MethodError{Method: call.Method, Code: protobuf.PErrorCode_P_ERROR_INTERNAL, Message: err.Error()}
+		}
+		return resultReply(nil, methodErr)
+	}
+	return resultReply(res, nil)
+}
+
+func resultReply(payload []byte, err *MethodError) ([]byte, error) {
+	res := &protobuf.PResult{Payload: payload}
+	if err != nil {
+		res.Error = &protobuf.PError{Code: err.Code, Message: err.Message}
+	}
+	return proto.Marshal(res)
+}
+
+// CallFunc sends a request and waits for its reply, AxTcpClient.Request is
+// one.
+type CallFunc func(ctx context.Context, data []byte) ([]byte, error)
+
+// Call invokes method on a Router and unmarshals the reply into resp. Error
+// replies are returned as *MethodError.
+func Call(ctx context.Context, call CallFunc, method string, req, resp proto.Message) error {
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(&protobuf.PCall{Method: method, Payload: payload})
+	if err != nil {
+		return err
+	}
+	if data, err = call(ctx, data); err != nil {
+		return err
+	}
+	var res protobuf.PResult
+	if err = proto.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	if res.Error != nil && res.Error.Code != protobuf.PErrorCode_P_ERROR_NONE {
+		return &MethodError{Method: method, Code: res.Error.Code, Message: res.Error.Message}
+	}
+	return proto.Unmarshal(res.Payload, resp)
+}
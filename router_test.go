@@ -0,0 +1,48 @@
+package axtransport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/axgrid/axtransport/protobuf"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	Handle(router, "Echo", func(req *protobuf.PChunk, ctx context.Context) (*protobuf.PChunk, error) {
+		return &protobuf.PChunk{MessageId: req.MessageId + 1, Data: req.Data}, nil
+	})
+	Handle(router, "Fail", func(req *protobuf.PChunk, ctx context.Context) (*protobuf.PChunk, error) {
+		return nil, errors.New("failed")
+	})
+	assert.Equal(t, []string{"Echo", "Fail"}, router.Methods())
+
+	transport := AxTransport().WithTCPServer("localhost", 8099).WithDataHandlerFunc(router.Serve).Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client, err := NewAxTcpClient("localhost:8099", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	client.SetHandler(nil)
+	require.Nil(t, client.Connect())
+	defer client.Disconnect()
+
+	var resp protobuf.PChunk
+	require.Nil(t, Call(context.Background(), client.Request, "Echo", &protobuf.PChunk{MessageId: 1, Data: []byte("data")}, &resp))
+	assert.Equal(t, uint64(2), resp.MessageId)
+	assert.Equal(t, "data", string(resp.Data))
+
+	err = Call(context.Background(), client.Request, "Missing", &protobuf.PChunk{}, &resp)
+	assert.ErrorIs(t, err, ErrUnknownMethod)
+
+	err = Call(context.Background(), client.Request, "Fail", &protobuf.PChunk{}, &resp)
+	var methodErr *MethodError
+	require.ErrorAs(t, err, &methodErr)
+	assert.Equal(t, protobuf.PErrorCode_P_ERROR_INTERNAL, methodErr.Code)
+	assert.Equal(t, "failed", methodErr.Message)
+	assert.NotErrorIs(t, err, ErrUnknownMethod)
+}
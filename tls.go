@@ -0,0 +1,84 @@
+package axtransport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+var ErrCertificatePinMismatch = errors.New("peer certificate does not match any pin")
+
+func TLSStateFromContext(ctx context.Context) (*tls.ConnectionState, bool) {
+	peer, ok := PeerFromContext(ctx)
+	if !ok || peer.TLS == nil {
+		return nil, false
+	}
+	return peer.TLS, true
+}
+
+// PeerCertificateFromContext returns the leaf certificate the peer presented
+// during the TLS handshake, or nil for plain connections.
+func PeerCertificateFromContext(ctx context.Context) *x509.Certificate {
+	state, ok := TLSStateFromContext(ctx)
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// CertificatePin returns the SHA-256 hash of the certificate public key (SPKI),
+// the value expected by SetPinnedCertificates.
+func CertificatePin(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// pinnedTLSConfig returns a copy of cfg that additionally requires a pin match.
+// Normally any certificate of a verified chain may match, so a CA can be pinned.
+// With InsecureSkipVerify the chain is unverified and only the leaf is compared;
+// the pin is then the only check, which allows self-signed server certificates.
+func pinnedTLSConfig(cfg *tls.Config, pins [][]byte) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if len(pins) == 0 {
+		return cfg
+	}
+	res := cfg.Clone()
+	verify := cfg.VerifyConnection
+	res.VerifyConnection = func(state tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(state); err != nil {
+				return err
+			}
+		}
+		if res.InsecureSkipVerify {
+			if len(state.PeerCertificates) > 0 && matchPin(state.PeerCertificates[0], pins) {
+				return nil
+			}
+			return ErrCertificatePinMismatch
+		}
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				if matchPin(cert, pins) {
+					return nil
+				}
+			}
+		}
+		return ErrCertificatePinMismatch
+	}
+	return res
+}
+
+func matchPin(cert *x509.Certificate, pins [][]byte) bool {
+	pin := CertificatePin(cert)
+	for _, p := range pins {
+		if bytes.Equal(pin, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package axtransport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	tlsCert tls.Certificate
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.tlsCert.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return &testCert{cert: cert, tlsCert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}}
+}
+
+func TestAxTcp_MutualTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, x509.ExtKeyUsageAny)
+	server := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		cert := PeerCertificateFromContext(ctx)
+		if cert == nil {
+			return []byte("anonymous"), nil
+		}
+		return []byte(cert.Subject.CommonName), nil
+	}
+	transport := AxTransport().
+		WithTCPServer("localhost", 8093).
+		WithTLS(&tls.Config{Certificates: []tls.Certificate{server.tlsCert}}).
+		WithClientCAs(pool).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	c, err := NewAxTcpClient("localhost:8093", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	c.SetHandler(nil)
+	c.SetTLS(&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{client.tlsCert}})
+	require.Nil(t, c.Connect())
+	defer c.Disconnect()
+	data, err := c.Request(context.Background(), []byte("who"))
+	require.Nil(t, err)
+	assert.Equal(t, "client", string(data))
+
+	anonymous, err := NewAxTcpClient("localhost:8093", nil, context.Background(), zerolog.Nop())
+	require.Nil(t, err)
+	anonymous.SetHandler(nil)
+	anonymous.SetTLS(&tls.Config{RootCAs: pool})
+	if err = anonymous.Connect(); err == nil {
+		defer anonymous.Disconnect()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = anonymous.Request(ctx, []byte("who"))
+	}
+	assert.NotNil(t, err)
+}
+
+func TestAxHttp_TLSPinning(t *testing.T) {
+	server := newTestCert(t, "server", nil, x509.ExtKeyUsageServerAuth)
+	other := newTestCert(t, "other", nil, x509.ExtKeyUsageServerAuth)
+	f := func(d []byte, ctx context.Context) ([]byte, error) {
+		state, ok := TLSStateFromContext(ctx)
+		if !ok || !state.HandshakeComplete {
+			return []byte("plain"), nil
+		}
+		return d, nil
+	}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8084).
+		WithTLS(&tls.Config{Certificates: []tls.Certificate{server.tlsCert}}).
+		WithDataHandlerFunc(f).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client := NewAxHttpClient(nil)
+	client.SetTLS(&tls.Config{InsecureSkipVerify: true})
+	client.SetPinnedCertificates(CertificatePin(server.cert))
+	data, err := client.Post("https://localhost:8084/api", []byte("pinned"))
+	require.Nil(t, err)
+	assert.Equal(t, "pinned", string(data))
+
+	client.SetPinnedCertificates(CertificatePin(other.cert))
+	_, err = client.Post("https://localhost:8084/api", []byte("pinned"))
+	assert.ErrorIs(t, err, ErrCertificatePinMismatch)
+}
+
+func TestAxHttp_TLSPinningChecksLeafOnly(t *testing.T) {
+	pinned := newTestCert(t, "pinned", nil, x509.ExtKeyUsageServerAuth)
+	attacker := newTestCert(t, "attacker", nil, x509.ExtKeyUsageServerAuth)
+	// The attacker presents its own leaf followed by the public pinned certificate.
+	chain := attacker.tlsCert
+	chain.Certificate = [][]byte{attacker.cert.Raw, pinned.cert.Raw}
+	transport := AxTransport().
+		WithHTTPServer("localhost", 8110).
+		WithTLS(&tls.Config{Certificates: []tls.Certificate{chain}}).
+		WithDataHandlerFunc(func(d []byte, ctx context.Context) ([]byte, error) { return d, nil }).
+		Build()
+	require.Nil(t, transport.Start())
+	defer transport.Stop()
+
+	client := NewAxHttpClient(nil)
+	client.SetTLS(&tls.Config{InsecureSkipVerify: true})
+	client.SetPinnedCertificates(CertificatePin(pinned.cert))
+	_, err := client.Post("https://localhost:8110/api", []byte("pinned"))
+	assert.ErrorIs(t, err, ErrCertificatePinMismatch)
+}